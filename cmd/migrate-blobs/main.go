@@ -0,0 +1,70 @@
+// Command migrate-blobs moves the content of existing snippets that is larger
+// than the blob threshold out of Postgres and into the blob store. That
+// covers every file of a snippet and of its revisions: extra files and
+// revisions still keeping their own copy of their content are moved to the
+// shared contents first. It takes the same blob store flags as the web
+// server and can be run while the server is up; run it again after lowering
+// -blob-threshold.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"snippetbox/cmd/web/config"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/blobstore"
+	"snippetbox/internal/models"
+)
+
+func main() {
+	dsn := flag.String("dsn", constants.DATABASE_CONNECTION_STRING, "PostgreSQL data source name")
+	blobFlags := config.NewBlobFlags()
+	batch := flag.Int("batch", 100, "Number of rows to move per batch")
+
+	flag.Parse()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	db := config.NewDatabaseConnection(dsn, logger)
+	defer db.DB.Close()
+
+	blobs, err := blobstore.Open(blobFlags.Options)
+	if err != nil {
+		logger.Error("Error creating the blob store", "error", err)
+		os.Exit(1)
+	}
+
+	snippets := models.NewSnippetModel(db.DB, blobs, blobFlags.Threshold)
+
+	shared := 0
+	for {
+		moved, err := snippets.ShareInlineFiles(context.Background(), *batch)
+		shared += moved
+		if err != nil {
+			logger.Error("Failed to share file content", "shared", shared, "error", err)
+			os.Exit(1)
+		}
+		if moved == 0 {
+			break
+		}
+		logger.Info("Shared the content of files and revisions", "shared", shared)
+	}
+
+	total := 0
+	for {
+		moved, err := snippets.MoveLargeContent(context.Background(), *batch)
+		total += moved
+		if err != nil {
+			logger.Error("Failed to move snippet content", "moved", total, "error", err)
+			os.Exit(1)
+		}
+		if moved == 0 {
+			break
+		}
+		logger.Info("Moved snippet content to the blob store", "moved", total)
+	}
+
+	logger.Info("Done", "shared", shared, "moved", total, "threshold", blobFlags.Threshold)
+}
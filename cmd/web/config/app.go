@@ -3,14 +3,27 @@ package config
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"snippetbox/cmd/web/constants"
 	"snippetbox/cmd/web/middlewares"
 	"snippetbox/cmd/web/templates"
+	"snippetbox/internal/analytics"
+	"snippetbox/internal/blobstore"
+	"snippetbox/internal/codeimage"
 	"snippetbox/internal/models"
+	"snippetbox/internal/moderation"
+	"snippetbox/internal/openapi"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/postgresstore"
@@ -18,18 +31,34 @@ import (
 	"github.com/go-playground/form/v4"
 )
 
+// maxPendingViews is how many snippet views are buffered before they are
+// saved without waiting for the next flush.
+const maxPendingViews = 1000
+
 type ApplicationConfig struct {
 	Logger         *slog.Logger
 	Middlewares    *middlewares.Middlewares
 	DB             *sql.DB
 	Snippets       *models.SnippetModel
 	Users          *models.UserModel
+	UserSessions   *models.UserSessionModel
+	APITokens      *models.APITokenModel
+	Attachments    *models.AttachmentModel
+	LineComments   *models.LineCommentModel
+	Comments       *models.CommentModel
+	Stars          *models.StarModel
+	Collections    *models.CollectionModel
+	Views          *analytics.Recorder
+	Moderation     moderation.Hook
+	Blobs          blobstore.BlobStore
+	CodeImages     *codeimage.Cache
 	TemplateCache  map[string]*template.Template
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+	APISpec        *openapi.Document
 }
 
-func NewApplicationConfigConnection(logger *slog.Logger, dsn *string) *ApplicationConfig {
+func NewApplicationConfigConnection(logger *slog.Logger, dsn *string, blobFlags *BlobFlags) *ApplicationConfig {
 	// Initializing the database connection and module.
 	db := NewDatabaseConnection(dsn, logger)
 
@@ -40,6 +69,25 @@ func NewApplicationConfigConnection(logger *slog.Logger, dsn *string) *Applicati
 		return nil
 	}
 
+	// Load the OpenAPI document describing the JSON API.
+	cwd, err := os.Getwd()
+	if err != nil {
+		logger.Error("Error getting the working directory", "error", err)
+		return nil
+	}
+	apiSpec, err := openapi.Load(filepath.Join(cwd, "ui", "api", "openapi.json"))
+	if err != nil {
+		logger.Error("Error loading the OpenAPI specification", "error", err)
+		return nil
+	}
+
+	// Initialize the blob store for uploaded files and large snippets.
+	blobs, err := blobstore.Open(blobFlags.Options)
+	if err != nil {
+		logger.Error("Error creating the blob store", "error", err)
+		return nil
+	}
+
 	sessionManager := scs.New()
 	sessionManager.Store = postgresstore.New(db.DB)
 	sessionManager.Lifetime = 12 * time.Hour
@@ -47,16 +95,30 @@ func NewApplicationConfigConnection(logger *slog.Logger, dsn *string) *Applicati
 	sessionManager.Cookie.SameSite = http.SameSiteLaxMode
 	sessionManager.Cookie.Secure = false // true in production
 
+	snippets := models.NewSnippetModel(db.DB, blobs, blobFlags.Threshold)
+
 	// Initialize the config with the database connection, logger and snippets model and return the instance.
 	return &ApplicationConfig{
 		Logger:         logger,
 		DB:             db.DB,
 		Middlewares:    middlewares.NewMiddlewares(),
-		Snippets:       models.NewSnippetModel(db.DB),
+		Snippets:       snippets,
 		Users:          models.NewUserModel(db.DB),
+		UserSessions:   models.NewUserSessionModel(db.DB),
+		APITokens:      models.NewAPITokenModel(db.DB),
+		Attachments:    models.NewAttachmentModel(db.DB),
+		LineComments:   models.NewLineCommentModel(db.DB),
+		Comments:       models.NewCommentModel(db.DB),
+		Stars:          models.NewStarModel(db.DB),
+		Collections:    models.NewCollectionModel(db.DB),
+		Views:          analytics.NewRecorder(snippets.RecordViews, logger, maxPendingViews),
+		Moderation:     moderation.Chain{moderation.MaxLinks(5)},
+		Blobs:          blobs,
+		CodeImages:     codeimage.NewCache(64 << 20),
 		TemplateCache:  templateCache,
 		FormDecoder:    form.NewDecoder(),
 		SessionManager: sessionManager,
+		APISpec:        apiSpec,
 	}
 }
 
@@ -103,3 +165,95 @@ func (app *ApplicationConfig) DecodePostForm(r *http.Request, dst any) error {
 
 	return nil
 }
+
+// DecodeJSON reads a single JSON object from the request body into dst. Unknown
+// fields and bodies over 1MB are rejected.
+func (app *ApplicationConfig) DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.As(err, &unmarshalTypeError):
+			return fmt.Errorf("body contains the wrong JSON type for field %q", unmarshalTypeError.Field)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return fmt.Errorf("body contains unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return errors.New("body contains badly-formed JSON")
+		}
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+// IsAuthenticated reports whether the Authenticate middleware found a valid
+// user for this request.
+func (app *ApplicationConfig) IsAuthenticated(r *http.Request) bool {
+	isAuthenticated, ok := r.Context().Value(constants.IsAuthenticatedContextKey).(bool)
+	if !ok {
+		return false
+	}
+
+	return isAuthenticated
+}
+
+// CurrentUser returns the user loaded by the Authenticate middleware, or nil
+// for anonymous requests.
+func (app *ApplicationConfig) CurrentUser(r *http.Request) *models.User {
+	user, ok := r.Context().Value(constants.CurrentUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+
+	return user
+}
+
+// APIToken returns the personal API token the request was authenticated with,
+// or nil when it came from a browser session or an anonymous visitor.
+func (app *ApplicationConfig) APIToken(r *http.Request) *models.APIToken {
+	token, ok := r.Context().Value(constants.APITokenContextKey).(*models.APIToken)
+	if !ok {
+		return nil
+	}
+
+	return token
+}
+
+// HasScope reports whether the request may act within the given token scope.
+// Browser sessions carry the full rights of the user and so have every scope.
+func (app *ApplicationConfig) HasScope(r *http.Request, scope string) bool {
+	token := app.APIToken(r)
+	if token == nil {
+		return app.IsAuthenticated(r)
+	}
+
+	return slices.Contains(token.Scopes, scope)
+}
+
+// ClientIP returns the IP address of the remote end of the request without the
+// port number.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/blobstore"
+	"snippetbox/internal/models"
+)
+
+// BlobFlags holds the command line flags that configure the blob store.
+type BlobFlags struct {
+	Options   blobstore.Options
+	Threshold int
+}
+
+// NewBlobFlags registers the blob store flags on the default flag set. S3
+// credentials are read from the usual AWS environment variables rather than
+// flags so they don't show up in process listings.
+func NewBlobFlags() *BlobFlags {
+	f := &BlobFlags{
+		Options: blobstore.Options{
+			S3AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+			S3SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		},
+	}
+
+	flag.StringVar(&f.Options.Dir, "blob-dir", constants.BLOB_DIR, "Directory for uploaded files and large snippets")
+	flag.StringVar(&f.Options.S3Endpoint, "s3-endpoint", "", "S3 compatible endpoint to store blobs in instead of -blob-dir, e.g. http://localhost:9000")
+	flag.StringVar(&f.Options.S3Bucket, "s3-bucket", "snippetbox", "S3 bucket for blobs")
+	flag.StringVar(&f.Options.S3Region, "s3-region", "us-east-1", "S3 region")
+	flag.IntVar(&f.Threshold, "blob-threshold", models.DefaultBlobThreshold, "Size in bytes above which snippet content is kept in the blob store")
+
+	return f
+}
@@ -1,8 +1,14 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"runtime/debug"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/models"
+	"strings"
 )
 
 func (app *ApplicationConfig) LogRequest(next http.Handler) http.Handler {
@@ -35,3 +41,163 @@ func (app *ApplicationConfig) RecoverPanic(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Authenticate loads the user referenced by the session (if any) and stores it
+// in the request context. It must run inside SessionManager.LoadAndSave.
+func (app *ApplicationConfig) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := app.SessionManager.GetInt(r.Context(), constants.SessionAuthenticatedUserID)
+		if id == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := app.Users.Get(id)
+		if err != nil {
+			// The user was deleted while the session was still alive, so drop the
+			// stale id and carry on as an anonymous visitor.
+			if errors.Is(err, models.ErrNoRecord) {
+				app.SessionManager.Remove(r.Context(), constants.SessionAuthenticatedUserID)
+				next.ServeHTTP(w, r)
+				return
+			}
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		// Keep the "last seen" details of the session page up to date. This is
+		// best effort, a failure here shouldn't stop the request.
+		err = app.UserSessions.Touch(app.SessionManager.Token(r.Context()), ClientIP(r))
+		if err != nil {
+			app.Logger.Error("Failed to update session activity", "error", err)
+		}
+
+		ctx := context.WithValue(r.Context(), constants.IsAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, constants.CurrentUserContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireAuthentication redirects anonymous visitors to the login page and
+// remembers where they were going so UserLoginPost can send them back.
+func (app *ApplicationConfig) RequireAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.IsAuthenticated(r) {
+			// r.URL has been through http.StripPrefix, so use the raw request
+			// URI to get the full path back.
+			if r.Method == http.MethodGet {
+				app.SessionManager.Put(r.Context(), constants.SessionRedirectAfterLogin, r.RequestURI)
+			}
+			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// Pages that require authentication should not be stored in caches.
+		w.Header().Add("Cache-Control", "no-store")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAnonymous keeps signed in users away from pages like login and
+// signup that only make sense for visitors.
+func (app *ApplicationConfig) RequireAnonymous(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.IsAuthenticated(r) {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthenticateToken accepts an "Authorization: Bearer <token>" header in place
+// of the session cookie and sets up the same user context Authenticate does.
+// The "token <token>" form used by GitHub clients is accepted too.
+func (app *ApplicationConfig) AuthenticateToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, plaintext, _ := strings.Cut(header, " ")
+		if (!strings.EqualFold(scheme, "Bearer") && !strings.EqualFold(scheme, "token")) || plaintext == "" {
+			app.InvalidAuthenticationToken()(w, r)
+			return
+		}
+
+		token, err := app.APITokens.Authenticate(plaintext)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.InvalidAuthenticationToken()(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		user, err := app.Users.Get(token.UserID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), constants.IsAuthenticatedContextKey, true)
+		ctx = context.WithValue(ctx, constants.CurrentUserContextKey, user)
+		ctx = context.WithValue(ctx, constants.APITokenContextKey, &token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireScope rejects token authenticated requests whose token was not
+// granted the scope. Anonymous requests are sent to log in as usual.
+func (app *ApplicationConfig) RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.HasScope(r, scope) {
+				app.ClientError(http.StatusForbidden)(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}))
+	}
+}
+
+// RequireSessionLogin guards account management pages that must only be used
+// by a person signed in through the browser, never by an API token.
+func (app *ApplicationConfig) RequireSessionLogin(next http.Handler) http.Handler {
+	return app.RequireAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.APIToken(r) != nil {
+			app.ClientError(http.StatusForbidden)(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// RequireTokenScope guards JSON API routes. Unlike RequireScope it answers with
+// an error envelope instead of redirecting to the login page.
+func (app *ApplicationConfig) RequireTokenScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.APIToken(r) == nil {
+				app.JSONError(http.StatusUnauthorized, "A valid API token is required", nil)(w, r)
+				return
+			}
+
+			if !app.HasScope(r, scope) {
+				app.JSONError(http.StatusForbidden, fmt.Sprintf("The API token is missing the %q scope", scope), nil)(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"runtime/debug"
 	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/validator"
+	"strconv"
 )
 
 func (app *ApplicationConfig) InternalServerError(err error) http.HandlerFunc {
@@ -53,6 +55,13 @@ func (app *ApplicationConfig) ClientError(status int) http.HandlerFunc {
 	}
 }
 
+func (app *ApplicationConfig) InvalidAuthenticationToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		app.JSONError(http.StatusUnauthorized, "The API token is invalid or has been revoked", nil)(w, r)
+	}
+}
+
 func (app *ApplicationConfig) SuccessResponseWriter() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -109,3 +118,78 @@ func (app *ApplicationConfig) ErrorResponseWriter(data map[string]string) http.H
 		w.Write(jsonResponse)
 	}
 }
+
+// WriteJSON encodes the value and writes it with the given status code.
+func (app *ApplicationConfig) WriteJSON(w http.ResponseWriter, r *http.Request, status int, value any) {
+	jsonResponse, err := json.Marshal(value)
+	if err != nil {
+		app.Logger.Error("Error marshalling JSON", "error", err)
+		app.InternalServerError(err)(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
+
+// JSONSuccess writes a constants.SuccessResponse envelope around the data.
+func (app *ApplicationConfig) JSONSuccess(status int, data map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.WriteJSON(w, r, status, constants.SuccessResponse{
+			Message: "Success",
+			SDESC:   http.StatusText(status),
+			SCODE:   strconv.Itoa(status),
+			DATA:    data,
+		})
+	}
+}
+
+// JSONError writes a constants.ErrorResponse envelope. The description is
+// meant for the API client, so never pass internal error messages to it.
+func (app *ApplicationConfig) JSONError(status int, description string, data map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if status == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+
+		app.WriteJSON(w, r, status, constants.ErrorResponse{
+			Error: http.StatusText(status),
+			SDESC: description,
+			SCODE: strconv.Itoa(status),
+			DATA:  data,
+		})
+	}
+}
+
+// JSONValidationError reports the field and non-field errors of a validator
+// the same way the HTML forms display them.
+func (app *ApplicationConfig) JSONValidationError(v validator.Validator) http.HandlerFunc {
+	fields := map[string]string{}
+	for field, message := range v.FieldErrors {
+		if message != "" {
+			fields[field] = message
+		}
+	}
+
+	data := map[string]interface{}{"fields": fields}
+	if len(v.NonFieldErrors) > 0 {
+		data["errors"] = v.NonFieldErrors
+	}
+
+	return app.JSONError(http.StatusUnprocessableEntity, "The request contains invalid fields", data)
+}
+
+// JSONInternalServerError logs the error and hides its details from the client.
+func (app *ApplicationConfig) JSONInternalServerError(err error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			method = r.Method
+			uri    = r.URL.RequestURI()
+			trace  = string(debug.Stack())
+		)
+
+		app.Logger.Error(err.Error(), "method", method, "uri", uri, "trace", trace)
+		app.JSONError(http.StatusInternalServerError, "An unexpected error occurred", nil)(w, r)
+	}
+}
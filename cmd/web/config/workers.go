@@ -0,0 +1,97 @@
+package config
+
+import (
+	"context"
+	"snippetbox/internal/models"
+	"time"
+)
+
+// expiryBatch is how many snippets or contents are deleted per transaction.
+const expiryBatch = 100
+
+// contentGrace is how long content nobody references is kept around, so that
+// pasting it again soon after is cheap.
+const contentGrace = time.Hour
+
+// RunExpiryWorker deletes expired snippets every interval and then garbage
+// collects the content they no longer reference. It runs until ctx is done.
+func (app *ApplicationConfig) RunExpiryWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.expireSnippets(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *ApplicationConfig) expireSnippets(ctx context.Context) {
+	snippets, contents := 0, 0
+
+	for {
+		n, err := app.Snippets.DeleteExpired(ctx, expiryBatch)
+		snippets += n
+		if err != nil {
+			app.Logger.Error("Failed to delete expired snippets", "error", err)
+			return
+		}
+		if n < expiryBatch {
+			break
+		}
+	}
+
+	for {
+		n, err := app.Snippets.CollectContents(ctx, contentGrace, expiryBatch)
+		contents += n
+		if err != nil {
+			app.Logger.Error("Failed to collect unreferenced snippet content", "error", err)
+			return
+		}
+		if n < expiryBatch {
+			break
+		}
+	}
+
+	if snippets > 0 || contents > 0 {
+		app.Logger.Info("Expired snippets", "snippets", snippets, "contents", contents)
+	}
+}
+
+// RunTrendingWorker recomputes the popularity scores of every trending window
+// each interval, so the trending page only has to read them, and prunes view
+// counts too old to matter. It runs until ctx is done.
+func (app *ApplicationConfig) RunTrendingWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.computeScores(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *ApplicationConfig) computeScores(ctx context.Context) {
+	var longest time.Duration
+
+	for _, window := range models.TrendingWindows {
+		longest = max(longest, window.Period)
+
+		if _, err := app.Snippets.ComputeScores(ctx, window); err != nil {
+			app.Logger.Error("Failed to compute trending scores", "window", window.Name, "error", err)
+		}
+	}
+
+	if _, err := app.Snippets.PruneViews(ctx, longest+time.Hour); err != nil {
+		app.Logger.Error("Failed to prune view counts", "error", err)
+	}
+}
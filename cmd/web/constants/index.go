@@ -2,6 +2,9 @@ package constants
 
 var PORT = ":4000"
 
+// Directory the local blob store keeps uploaded files in.
+var BLOB_DIR = "./data/blobs"
+
 // Database connectiong string for local.
 var DATABASE_CONNECTION_STRING = "user=web password=snippet@123 dbname=snippetbox sslmode=disable"
 
@@ -25,6 +28,24 @@ var (
 	ErrInvalidEmail    = "This field must be a valid email address"
 	ErrInvalidUsername = "This field must be a valid username"
 	ErrInvalidPassword = "This field must be a valid password"
+	ErrInvalidLanguage = "This field must be a lowercase language name like go or python"
 	ErrMinChars        = "This field must be more than %d characters long"
 	ErrMaxChars        = "This field must be less than %d characters long"
 )
+
+// Define a custom contextKey type so our request context keys can't collide
+// with keys set by any third-party packages.
+type contextKey string
+
+const (
+	IsAuthenticatedContextKey = contextKey("isAuthenticated")
+	CurrentUserContextKey     = contextKey("currentUser")
+	APITokenContextKey        = contextKey("apiToken")
+)
+
+// Session keys shared between the handlers and the middlewares.
+const (
+	SessionAuthenticatedUserID = "authenticatedUserID"
+	SessionRedirectAfterLogin  = "redirectPathAfterLogin"
+	SessionNewAPIToken         = "newAPIToken"
+)
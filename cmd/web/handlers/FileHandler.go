@@ -1 +1,439 @@
 package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"snippetbox/internal/blobstore"
+	"snippetbox/internal/images"
+	"snippetbox/internal/models"
+	"strconv"
+	"strings"
+)
+
+// maxAttachmentBytes caps the size of a single uploaded file.
+const maxAttachmentBytes = 25 << 20
+
+// maxImageBytes caps the size of an uploaded image, which is read into memory
+// to be checked and cleaned up.
+const maxImageBytes = 10 << 20
+
+// attachmentNameRX is the filename allowlist: a plain name made of safe
+// characters with one of the extensions we accept, or a core dump name like
+// "core" or "core.1234".
+var attachmentNameRX = regexp.MustCompile(`(?i)^(?:[a-z0-9][a-z0-9 _.,()+-]{0,200}\.(?:txt|log|out|err|json|xml|yaml|yml|csv|tsv|diff|patch|har|png|jpe?g|gif|webp|pdf|zip|gz|tgz|tar|xz|zst|dmp|mdmp|core|trace|pprof)|core(?:\.[0-9]+)?)$`)
+
+// attachmentTypes lists the sniffed content types we accept. Anything else,
+// HTML in particular, is refused whatever its file name says.
+var attachmentTypes = []string{
+	"text/plain; charset=utf-8",
+	"text/plain; charset=utf-16be",
+	"text/plain; charset=utf-16le",
+	"text/xml; charset=utf-8",
+	"application/json",
+	"application/pdf",
+	"application/zip",
+	"application/x-gzip",
+	"application/octet-stream",
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+}
+
+// imageTypes are the sniffed content types handled as images: decoded to
+// check them, stripped of metadata, shown inline and given a thumbnail.
+var imageTypes = []string{"image/png", "image/jpeg", "image/gif"}
+
+// inlineAttachmentTypes are safe to display in the browser. Every other type
+// is always downloaded.
+var inlineAttachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+var (
+	errUploadName = errors.New("upload: file name not allowed")
+	errUploadType = errors.New("upload: content type not allowed")
+)
+
+// uploadErrorMessage returns what to tell the user about a rejected upload,
+// or "" when the error isn't their fault.
+func uploadErrorMessage(err error) string {
+	var maxBytesError *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, errUploadName), errors.Is(err, errUploadType):
+		return "That type of file can't be attached."
+	case errors.Is(err, images.ErrUnsupported):
+		return "That image could not be read. Only PNG, JPEG and GIF images are supported."
+	case errors.Is(err, images.ErrTooLarge):
+		return "That image is too large."
+	case errors.As(err, &maxBytesError):
+		return fmt.Sprintf("Files can be at most %d MB, images at most %d MB.", maxAttachmentBytes>>20, maxImageBytes>>20)
+	}
+
+	return ""
+}
+
+// upload is a file that passed the checks and is ready to be stored.
+type upload struct {
+	filename    string
+	contentType string
+	// body is the rest of the file for anything but images, which are
+	// already read and processed into image.
+	body  io.Reader
+	image *images.Image
+}
+
+// prepareUpload checks the name and the sniffed type of a file. Images are
+// read and processed straight away, so a broken one is reported before
+// anything is stored.
+func prepareUpload(filename string, r io.Reader) (*upload, error) {
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if !attachmentNameRX.MatchString(filename) {
+		return nil, errUploadName
+	}
+
+	// Sniff the real type from the first bytes rather than trusting the
+	// browser or the file extension.
+	body := bufio.NewReaderSize(r, 512)
+	head, err := body.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	contentType := http.DetectContentType(head)
+	if !slices.Contains(attachmentTypes, contentType) {
+		return nil, errUploadType
+	}
+
+	if !slices.Contains(imageTypes, contentType) {
+		return &upload{filename: filename, contentType: contentType, body: body}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageBytes {
+		return nil, &http.MaxBytesError{Limit: maxImageBytes}
+	}
+
+	img, err := images.Process(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &upload{filename: filename, contentType: img.ContentType, image: img}, nil
+}
+
+// storeUpload writes a prepared file to the blob store and attaches it to a
+// snippet.
+func (app *Application) storeUpload(ctx context.Context, snippetID, userID int, u *upload) error {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+
+	a := models.Attachment{
+		SnippetID:   snippetID,
+		UserID:      userID,
+		Filename:    u.filename,
+		ContentType: u.contentType,
+		StorageKey:  fmt.Sprintf("attachments/%d/%s", snippetID, hex.EncodeToString(random)),
+	}
+
+	var err error
+	if u.image != nil {
+		sum := sha256.Sum256(u.image.Data)
+		a.Size, a.SHA256 = int64(len(u.image.Data)), hex.EncodeToString(sum[:])
+		a.Width, a.Height = u.image.Width, u.image.Height
+		a.ThumbKey = a.StorageKey + "-thumb"
+
+		err = app.Blobs.Put(ctx, a.StorageKey, bytes.NewReader(u.image.Data), a.ContentType)
+		if err == nil {
+			err = app.Blobs.Put(ctx, a.ThumbKey, bytes.NewReader(u.image.Thumbnail), "image/png")
+		}
+	} else {
+		counter := newCountingHasher(io.LimitReader(u.body, maxAttachmentBytes+1))
+		err = app.Blobs.Put(ctx, a.StorageKey, counter, a.ContentType)
+		if err == nil && counter.n > maxAttachmentBytes {
+			err = &http.MaxBytesError{Limit: maxAttachmentBytes}
+		}
+		a.Size, a.SHA256 = counter.n, hex.EncodeToString(counter.hash.Sum(nil))
+	}
+
+	if err == nil {
+		_, err = app.Attachments.Insert(a)
+	}
+	if err != nil {
+		for _, key := range a.BlobKeys() {
+			app.Blobs.Delete(ctx, key)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ownedSnippetFromPath is snippetFromPath for pages that change a snippet,
+// which only its owner may do.
+func (app *Application) ownedSnippetFromPath(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.snippetFromPath(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if snippet.UserID == 0 || snippet.UserID != app.CurrentUser(r).ID {
+		app.ClientError(http.StatusForbidden)(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// countingHasher tracks the size and SHA-256 of everything read through it.
+type countingHasher struct {
+	r    io.Reader
+	n    int64
+	hash hash.Hash
+}
+
+func newCountingHasher(r io.Reader) *countingHasher {
+	return &countingHasher{r: r, hash: sha256.New()}
+}
+
+func (c *countingHasher) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.hash.Write(p[:n])
+	return n, err
+}
+
+func (app *Application) PostAttachment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.ownedSnippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		back := fmt.Sprintf("/snippet/view/%d#attachments", snippet.ID)
+
+		// Leave some room for the multipart headers on top of the file.
+		r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentBytes+64<<10)
+
+		mr, err := r.MultipartReader()
+		if err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		part, err := mr.NextPart()
+		for err == nil && part.FormName() != "file" {
+			part, err = mr.NextPart()
+		}
+		if err != nil || part.FileName() == "" {
+			app.SessionManager.Put(r.Context(), "flash", "Choose a file to upload.")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		defer part.Close()
+
+		u, err := prepareUpload(part.FileName(), part)
+		if err == nil {
+			err = app.storeUpload(r.Context(), snippet.ID, app.CurrentUser(r).ID, u)
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.ClientError(http.StatusRequestEntityTooLarge)(w, r)
+				return
+			}
+			if message := uploadErrorMessage(err); message != "" {
+				app.SessionManager.Put(r.Context(), "flash", message)
+				http.Redirect(w, r, back, http.StatusSeeOther)
+				return
+			}
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "File attached.")
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+// attachmentFromPath loads the attachment named by the {attachment} path value
+// of the snippet named by {id}.
+func (app *Application) attachmentFromPath(w http.ResponseWriter, r *http.Request, snippet models.Snippet) (models.Attachment, bool) {
+	id, err := strconv.Atoi(r.PathValue("attachment"))
+	if err != nil || id < 1 {
+		app.NotFound(fmt.Errorf("invalid attachment id %q", r.PathValue("attachment")))(w, r)
+		return models.Attachment{}, false
+	}
+
+	attachment, err := app.Attachments.Get(id, snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(err)(w, r)
+		} else {
+			app.InternalServerError(err)(w, r)
+		}
+		return models.Attachment{}, false
+	}
+
+	return attachment, true
+}
+
+func (app *Application) GetAttachment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		attachment, ok := app.attachmentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+
+		disposition := "attachment"
+		if slices.Contains(inlineAttachmentTypes, attachment.ContentType) {
+			disposition = "inline"
+		}
+
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+			"filename": attachment.Filename,
+		}))
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+
+		app.serveAttachmentBlob(w, r, snippet, attachment, attachment.StorageKey, attachment.ContentType, `"`+attachment.SHA256+`"`)
+	}
+}
+
+func (app *Application) GetAttachmentThumbnail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		attachment, ok := app.attachmentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+		if !attachment.IsImage() {
+			app.NotFound(fmt.Errorf("attachment %d has no thumbnail", attachment.ID))(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", "inline")
+
+		app.serveAttachmentBlob(w, r, snippet, attachment, attachment.ThumbKey, "image/png", `"`+attachment.SHA256+`-thumb"`)
+	}
+}
+
+// serveAttachmentBlob writes one of the blobs of an attachment. The stored
+// type was sniffed on upload, nosniff (set globally) stops the browser second
+// guessing it, and the sandbox CSP neuters anything that still manages to be
+// rendered.
+func (app *Application) serveAttachmentBlob(w http.ResponseWriter, r *http.Request, snippet models.Snippet, attachment models.Attachment, key, contentType, etag string) {
+	// Images are fetched over and over by the view and listing pages, so
+	// those of public snippets may be cached for a few minutes, after which
+	// the entity tag makes revalidating them cheap. Only a short time, as
+	// shared caches keep serving them after the attachment is deleted or
+	// the snippet made private. Anything else, including everything of
+	// unlisted snippets, whose links only go to people the owner chose, is
+	// kept out of shared caches and revalidated every time.
+	if attachment.IsImage() && snippet.IsPublic() {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := app.Blobs.Get(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			app.NotFound(err)(w, r)
+		} else {
+			app.InternalServerError(err)(w, r)
+		}
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.Header().Set("Last-Modified", attachment.Created.UTC().Format(http.TimeFormat))
+
+	io.Copy(w, blob)
+}
+
+func (app *Application) DeleteAttachment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.ownedSnippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		attachment, ok := app.attachmentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+
+		err := app.Attachments.Delete(attachment.ID, snippet.ID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		// The row is gone, so a blob left behind is only wasted space.
+		app.deleteAttachmentBlobs(r.Context(), attachment)
+
+		app.SessionManager.Put(r.Context(), "flash", "Attachment deleted.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#attachments", snippet.ID), http.StatusSeeOther)
+	}
+}
+
+func (app *Application) deleteAttachmentBlobs(ctx context.Context, attachment models.Attachment) {
+	for _, key := range attachment.BlobKeys() {
+		if err := app.Blobs.Delete(ctx, key); err != nil {
+			app.Logger.Error("Failed to delete attachment blob", "key", key, "error", err)
+		}
+	}
+}
+
+// deleteSnippet deletes a snippet together with the blobs of its attachments.
+// The rows go with the snippet, so the keys are collected first.
+func (app *Application) deleteSnippet(ctx context.Context, snippet models.Snippet) error {
+	attachments, err := app.Attachments.ForSnippet(snippet.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = app.Snippets.Delete(snippet.ID, snippet.UserID); err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		app.deleteAttachmentBlobs(ctx, attachment)
+	}
+
+	return nil
+}
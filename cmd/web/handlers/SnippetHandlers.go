@@ -1,23 +1,230 @@
 package handlers
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"snippetbox/cmd/web/config"
 	structs "snippetbox/cmd/web/structs"
+	"snippetbox/cmd/web/templates"
+	"snippetbox/internal/archive"
+	"snippetbox/internal/highlight"
+	"snippetbox/internal/markdown"
 	"snippetbox/internal/models"
 	"snippetbox/internal/validator"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// snippetPage is the data behind the snippet view page.
+type snippetPage struct {
+	models.Snippet
+	Files []snippetFileView
+	// Images are the attachments shown inline, Attachments the rest.
+	Images      []models.Attachment
+	Attachments []models.Attachment
+	IsOwner     bool
+	// Duplicates is how many other snippets the viewer can see have the
+	// same content.
+	Duplicates int
+	// CanComment is set for signed in viewers, who may review the code.
+	CanComment bool
+	// OutdatedThreads are review threads on lines that have since changed.
+	OutdatedThreads []*lineThread
+	// Comments is the discussion under the snippet.
+	Comments []commentView
+	// Parent is the snippet this one was forked from, when the viewer can
+	// still see it, and Forks how many others forked this one.
+	Parent *models.Snippet
+	Forks  int
+	// Starred is set when the viewer starred the snippet.
+	Starred bool
+	// Collections are the public collections holding the snippet and the
+	// viewer's own, and Collectable the viewer's collections it can be
+	// added to.
+	Collections []models.Collection
+	Collectable []models.Collection
+}
+
+type snippetFileView struct {
+	models.SnippetFile
+	Name   string
+	Anchor string
+	// LinePrefix starts the anchor of each line, "L" for the first file so
+	// that links read like #L10-L25, and the file anchor for the others.
+	LinePrefix string
+	// Threads are the review threads on the file.
+	Threads []*lineThread
+	// Markdown files are shown rendered, with a table of contents, unless
+	// the source was asked for.
+	Markdown bool
+	Rendered template.HTML
+	TOC      []markdown.Heading
+}
+
+// codeBlock is a run of lines followed by the review threads that end on its
+// last line.
+type codeBlock struct {
+	Lines   []codeLine
+	Threads []*lineThread
+}
+
+// codeLine is a numbered line of a file on the view page.
+type codeLine struct {
+	Number int
+	ID     string
+	Text   template.HTML
+}
+
+// Blocks splits the lines of the file after every line that has review
+// threads, so the threads can be shown below the code they are about.
+func (f snippetFileView) Blocks() []codeBlock {
+	ending := map[int][]*lineThread{}
+	for _, t := range f.Threads {
+		ending[t.EndLine] = append(ending[t.EndLine], t)
+	}
+
+	blocks := []codeBlock{{}}
+	lines := f.Lines()
+	for _, line := range lines {
+		last := &blocks[len(blocks)-1]
+		last.Lines = append(last.Lines, line)
+		if threads, ok := ending[line.Number]; ok {
+			last.Threads = threads
+			delete(ending, line.Number)
+			if line.Number < len(lines) {
+				blocks = append(blocks, codeBlock{})
+			}
+		}
+	}
+	// Threads past the end can't happen unless the file changed under them,
+	// they still shouldn't disappear.
+	for _, threads := range ending {
+		blocks[len(blocks)-1].Threads = append(blocks[len(blocks)-1].Threads, threads...)
+	}
+
+	return blocks
+}
+
+// Lines splits the file into numbered, highlighted lines, each with its own
+// anchor.
+func (f snippetFileView) Lines() []codeLine {
+	language := f.Language
+	if language == "" {
+		language = models.LanguageForFilename(f.Name)
+	}
+	lines := highlight.Lines(language, f.Content)
+	numbered := make([]codeLine, len(lines))
+	for i, text := range lines {
+		numbered[i] = codeLine{Number: i + 1, ID: f.LinePrefix + strconv.Itoa(i+1), Text: text}
+	}
+	return numbered
+}
+
+// fileAnchorRX matches the characters that can't appear in a file anchor.
+var fileAnchorRX = regexp.MustCompile(`[^a-z0-9_.-]+`)
+
+// newSnippetFileViews prepares the files of a snippet for display. Markdown
+// files are rendered unless source is set.
+func newSnippetFileViews(snippet models.Snippet, files []models.SnippetFile, source bool) []snippetFileView {
+	views := []snippetFileView{}
+	for i, f := range files {
+		name := f.DisplayName(snippet.ID, i)
+		view := snippetFileView{
+			SnippetFile: f,
+			Name:        name,
+			Anchor:      "file-" + fileAnchorRX.ReplaceAllString(strings.ToLower(name), "-"),
+			LinePrefix:  "L",
+			Markdown:    f.Language == "markdown" || f.Language == "" && models.LanguageForFilename(name) == "markdown",
+		}
+		if i > 0 {
+			view.LinePrefix = view.Anchor + "-L"
+		}
+		if view.Markdown && !source {
+			view.Rendered, view.TOC = markdown.Document(f.Content, view.Anchor+"-")
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// snippetFromPath loads the snippet named by the {id} path value and writes
+// a 404 or 500 response itself when it can't, in which case ok is false.
+func (app *Application) snippetFromPath(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.NotFound(fmt.Errorf("invalid snippet id %q", r.PathValue("id")))(w, r)
+		return models.Snippet{}, false
+	}
+
+	snippet, err = app.Snippets.Get(id)
+	if err == nil && !app.canView(r, snippet) {
+		err = models.ErrNoRecord
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(err)(w, r)
+		} else {
+			app.InternalServerError(err)(w, r)
+		}
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// canView reports whether the requester may see a snippet. Private snippets
+// are treated as missing for everyone but their owner.
+func (app *Application) canView(r *http.Request, snippet models.Snippet) bool {
+	return snippet.VisibleTo(app.viewerID(r))
+}
+
+// viewerID is the id of the current user, or 0 for anonymous visitors. API
+// tokens without the snippets:read scope count as anonymous, so they can't
+// read what only their owner may see.
+func (app *Application) viewerID(r *http.Request) int {
+	user := app.CurrentUser(r)
+	if user == nil {
+		return 0
+	}
+	if app.APIToken(r) != nil && !app.HasScope(r, models.ScopeSnippetsRead) {
+		return 0
+	}
+	return user.ID
+}
+
+// renderCreateSnippet shows the create form. There is always at least one
+// file slot to fill in.
+func (app *Application) renderCreateSnippet(w http.ResponseWriter, r *http.Request, status int, form *structs.SnippetStruct) {
+	data := NewTemplateData[structs.SnippetStruct, models.Snippet](app, r, form, structs.SnippetStruct{})
+	if len(data.Form.Files) == 0 {
+		data.Form.Files = []structs.SnippetFileStruct{{}}
+	}
+
+	app.Render(w, r, status, "create.tmpl.html", data)
+}
+
 func (app *Application) GetCreateSnippet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data := NewTemplateData[structs.SnippetStruct, models.Snippet](app, r, nil, structs.SnippetStruct{})
-
-		app.Render(w, r, http.StatusOK, "create.tmpl.html", data)
+		app.renderCreateSnippet(w, r, http.StatusOK, nil)
 	}
 }
 
+// maxCreateBytes caps the size of the create form including its images, of
+// which up to maxCreateMemory are held in memory while parsing.
+const (
+	maxCreateBytes  = 40 << 20
+	maxCreateMemory = 8 << 20
+)
+
 func (app *Application) PostCreateSnippet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -25,27 +232,102 @@ func (app *Application) PostCreateSnippet() http.HandlerFunc {
 			Validator: validator.New(&models.Snippet{}),
 		}
 
+		// The form is sent as multipart/form-data so it can carry images.
+		r.Body = http.MaxBytesReader(w, r.Body, maxCreateBytes)
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+			err := r.ParseMultipartForm(maxCreateMemory)
+			if err != nil {
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					app.ClientError(http.StatusRequestEntityTooLarge)(w, r)
+				} else {
+					app.ClientError(http.StatusBadRequest)(w, r)
+				}
+				return
+			}
+			defer r.MultipartForm.RemoveAll()
+		}
+
 		err := app.DecodePostForm(r, &form)
 		if err != nil {
 			app.ClientError(http.StatusBadRequest)(w, r)
 			return
 		}
 
+		form.DropBlankFiles()
+
+		// Browsers send an empty part when no image was chosen.
+		var imageFiles []*multipart.FileHeader
+		if r.MultipartForm != nil {
+			for _, fh := range r.MultipartForm.File["images"] {
+				if fh.Filename != "" || fh.Size > 0 {
+					imageFiles = append(imageFiles, fh)
+				}
+			}
+		}
+		form.Images = len(imageFiles)
+
+		// The "Add another file" button submits the form too. Show it again
+		// with an extra file slot rather than publishing the snippet.
+		if r.PostForm.Get("action") == "add-file" {
+			if len(form.Files) < structs.MaxSnippetFiles {
+				form.Files = append(form.Files, structs.SnippetFileStruct{})
+			}
+			app.renderCreateSnippet(w, r, http.StatusOK, form)
+			return
+		}
+
 		form.Validate()
 
+		// Check every image before creating anything, so a bad one can be
+		// reported on the form.
+		var uploads []*upload
+		for _, fh := range imageFiles {
+			if !form.Valid() {
+				break
+			}
+
+			f, err := fh.Open()
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+			u, err := prepareUpload(fh.Filename, f)
+			f.Close()
+
+			switch {
+			case err == nil && u.image == nil:
+				form.AddFieldError("Images", fh.Filename+": only PNG, JPEG and GIF images can be added here.")
+			case err != nil && uploadErrorMessage(err) != "":
+				form.AddFieldError("Images", fh.Filename+": "+uploadErrorMessage(err))
+			case err != nil:
+				app.InternalServerError(err)(w, r)
+				return
+			default:
+				uploads = append(uploads, u)
+			}
+		}
+
 		if !form.Valid() {
-			data := NewTemplateData[structs.SnippetStruct, models.Snippet](app, r, nil, structs.SnippetStruct{})
-			data.Form = form
-			app.Render(w, r, http.StatusUnprocessableEntity, "create.tmpl.html", data)
+			app.renderCreateSnippet(w, r, http.StatusUnprocessableEntity, form)
 			return
 		}
 
-		id, err := app.Snippets.Insert(form.Title, form.Content, form.Expires)
+		userID := app.CurrentUser(r).ID
+
+		id, err := app.Snippets.InsertFiles(userID, form.Title, form.SnippetFiles(), form.VisibilityOr(models.VisibilityPublic), form.Expires)
 		if err != nil {
 			app.InternalServerError(err)(w, r)
 			return
 		}
 
+		for _, u := range uploads {
+			if err = app.storeUpload(r.Context(), id, userID, u); err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+		}
+
 		// Set a flash message to the session
 		app.SessionManager.Put(r.Context(), "flash", "Snippet successfully created!")
 
@@ -53,6 +335,35 @@ func (app *Application) PostCreateSnippet() http.HandlerFunc {
 	}
 }
 
+// snippetListItem is a row of a snippet listing page.
+type snippetListItem struct {
+	models.Snippet
+	// Thumbnail is the first image of the snippet, if it has any.
+	Thumbnail *models.Attachment
+}
+
+func (app *Application) newSnippetListItems(snippets []models.Snippet) ([]snippetListItem, error) {
+	ids := make([]int, len(snippets))
+	for i, s := range snippets {
+		ids[i] = s.ID
+	}
+
+	thumbnails, err := app.Attachments.Thumbnails(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]snippetListItem, len(snippets))
+	for i, s := range snippets {
+		items[i].Snippet = s
+		if t, ok := thumbnails[s.ID]; ok {
+			items[i].Thumbnail = &t
+		}
+	}
+
+	return items, nil
+}
+
 func (app *Application) GetSnippetHome() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -62,8 +373,14 @@ func (app *Application) GetSnippetHome() http.HandlerFunc {
 			return
 		}
 
-		data := NewTemplateData[structs.SnippetStruct, []models.Snippet](app, r, nil, structs.SnippetStruct{})
-		data.Data = snippets
+		items, err := app.newSnippetListItems(snippets)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		data := NewTemplateData[structs.SnippetStruct, []snippetListItem](app, r, nil, structs.SnippetStruct{})
+		data.Data = items
 
 		app.Render(w, r, http.StatusOK, "home.tmpl.html", data)
 	}
@@ -83,8 +400,14 @@ func (app *Application) UpdateSnippetById() http.HandlerFunc {
 			return
 		}
 
-		data := NewTemplateData[structs.SnippetStruct, []models.Snippet](app, r, nil, structs.SnippetStruct{})
-		data.Data = snippets
+		items, err := app.newSnippetListItems(snippets)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		data := NewTemplateData[structs.SnippetStruct, []snippetListItem](app, r, nil, structs.SnippetStruct{})
+		data.Data = items
 
 		app.Render(w, r, http.StatusOK, "home.tmpl.html", data)
 	}
@@ -92,39 +415,331 @@ func (app *Application) UpdateSnippetById() http.HandlerFunc {
 
 func (app *Application) GetSnippetById() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		id, err := strconv.Atoi(r.PathValue("id"))
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
 
-		if err != nil || id < 1 {
-			app.NotFound(err)(w, r)
+		// The same URL serves the page, the bare text and JSON depending on the
+		// Accept header, so caches must keep the variants apart.
+		w.Header().Add("Vary", "Accept")
+
+		switch negotiate(r, "text/html", "text/plain", "application/json") {
+		case "text/html":
+			files, err := app.Snippets.Files(snippet)
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			attachments, err := app.Attachments.ForSnippet(snippet.ID)
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			duplicates, err := app.Snippets.Duplicates(snippet, app.viewerID(r))
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			comments, err := app.LineComments.ForSnippet(snippet.ID)
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			viewerID := app.viewerID(r)
+			isOwner := snippet.UserID != 0 && snippet.UserID == viewerID
+
+			// Owners looking at their own snippet don't make it popular.
+			// Views are counted in memory and saved in batches.
+			if !isOwner && r.Method == http.MethodGet {
+				app.Views.Record(snippet.ID, config.ClientIP(r), r.UserAgent())
+			}
+
+			discussion, err := app.Comments.ForSnippet(snippet.ID, viewerID, isOwner)
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			forks, err := app.Snippets.ForkCount(snippet.ID)
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			starred := false
+			if viewerID != 0 {
+				if starred, err = app.Stars.Starred(viewerID, snippet.ID); err != nil {
+					app.InternalServerError(err)(w, r)
+					return
+				}
+			}
+
+			collections, err := app.Collections.Containing(snippet.ID, viewerID)
+			if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+
+			var collectable []models.Collection
+			if viewerID != 0 {
+				own, err := app.Collections.ForUser(viewerID)
+				if err != nil {
+					app.InternalServerError(err)(w, r)
+					return
+				}
+				for _, c := range own {
+					if !slices.ContainsFunc(collections, func(in models.Collection) bool { return in.ID == c.ID }) {
+						collectable = append(collectable, c)
+					}
+				}
+			}
+
+			var parent *models.Snippet
+			if snippet.ForkedFrom != 0 {
+				p, err := app.Snippets.Get(snippet.ForkedFrom)
+				if err != nil && !errors.Is(err, models.ErrNoRecord) {
+					app.InternalServerError(err)(w, r)
+					return
+				}
+				if err == nil && app.canView(r, p) {
+					parent = &p
+				}
+			}
+
+			var images, others []models.Attachment
+			for _, a := range attachments {
+				if a.IsImage() {
+					images = append(images, a)
+				} else {
+					others = append(others, a)
+				}
+			}
+
+			data := NewTemplateData[structs.SnippetStruct, snippetPage](app, r, nil, structs.SnippetStruct{})
+			threads, outdated := newLineThreads(comments, data.IsAuthenticated)
+			fileViews := newSnippetFileViews(snippet, files, r.URL.Query().Get("source") != "")
+			for i := range fileViews {
+				fileViews[i].Threads = threads[fileViews[i].Name]
+			}
+
+			data.Data = snippetPage{
+				Snippet:         snippet,
+				Files:           fileViews,
+				Images:          images,
+				Attachments:     others,
+				IsOwner:         isOwner,
+				Duplicates:      duplicates,
+				CanComment:      data.IsAuthenticated,
+				OutdatedThreads: outdated,
+				Comments:        newCommentViews(discussion, viewerID),
+				Parent:          parent,
+				Forks:           forks,
+				Starred:         starred,
+				Collections:     collections,
+				Collectable:     collectable,
+			}
+			data.Meta = snippetMeta(r, snippet, images, data.Meta)
+
+			app.Render(w, r, http.StatusOK, "view.tmpl.html", data)
+		case "text/plain":
+			app.serveSnippetContent(w, r, models.SnippetFile{Filename: snippet.Filename, Language: snippet.Language}.DisplayName(snippet.ID, 0),
+				snippet.Content, snippet.Updated, false)
+		case "application/json":
+			app.JSONSuccess(http.StatusOK, map[string]interface{}{"snippet": snippet})(w, r)
+		default:
+			app.ClientError(http.StatusNotAcceptable)(w, r)
+		}
+	}
+}
+
+// maxMetaDescription is how much of a snippet its page description quotes.
+const maxMetaDescription = 200
+
+// snippetMeta describes a snippet page for link previews. Only public
+// snippets say what's in them; the rest keep the defaults and ask not to be
+// indexed, since anyone pasting a link into a chat would otherwise hand
+// their content to the chat's crawler.
+func snippetMeta(r *http.Request, snippet models.Snippet, images []models.Attachment, meta templates.PageMeta) templates.PageMeta {
+	meta.URL = absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID))
+	if !snippet.IsPublic() {
+		meta.NoIndex = true
+		return meta
+	}
+
+	meta.Title = snippet.Title
+	meta.OEmbed = absoluteURL(r, "/oembed?url="+url.QueryEscape(meta.URL))
+	if len(images) > 0 && snippet.Content == "" {
+		meta.Description = fmt.Sprintf("%d images on Snippetbox", len(images))
+		if len(images) == 1 {
+			meta.Description = "An image on Snippetbox"
+		}
+		meta.Image = absoluteURL(r, fmt.Sprintf("/snippet/attachment/%d/%d", snippet.ID, images[0].ID))
+		return meta
+	}
+
+	description := strings.Join(strings.Fields(snippet.Content), " ")
+	if runes := []rune(description); len(runes) > maxMetaDescription {
+		description = string(runes[:maxMetaDescription-1]) + "…"
+	}
+	if description != "" {
+		meta.Description = description
+	}
+	meta.Image = absoluteURL(r, fmt.Sprintf("/snippet/card/%d.png", snippet.ID))
+
+	return meta
+}
+
+func (app *Application) GetRawSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
 			return
 		}
 
-		snippet, err := app.Snippets.Get(id)
+		query := r.URL.Query()
+		modified := snippet.Updated
 
-		if err != nil {
-			if errors.Is(err, models.ErrNoRecord) {
-				app.NotFound(err)(w, r)
-			} else {
+		// ?version= serves the files of an older revision instead.
+		var files []models.SnippetFile
+		var err error
+		if version := query.Get("version"); version != "" {
+			revision, err := app.Snippets.Revision(snippet.ID, version)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					app.NotFound(err)(w, r)
+				} else {
+					app.InternalServerError(err)(w, r)
+				}
+				return
+			}
+			files, modified = revision.Files, revision.Committed
+		} else {
+			files, err = app.Snippets.Files(snippet)
+			if err != nil {
 				app.InternalServerError(err)(w, r)
+				return
+			}
+		}
+
+		// ?file= picks a file by name, otherwise the first file is served.
+		for i, f := range files {
+			name := f.DisplayName(snippet.ID, i)
+			if query.Get("file") == "" || query.Get("file") == name {
+				app.serveSnippetContent(w, r, name, f.Content, modified, query.Has("download"))
+				return
 			}
+		}
+
+		app.NotFound(fmt.Errorf("snippet %d has no file %q", snippet.ID, query.Get("file")))(w, r)
+	}
+}
+
+// serveSnippetContent writes bare snippet content as plain text, whatever the
+// file type, so uploaded markup is never rendered by the browser. It goes
+// through http.ServeContent so conditional (If-None-Match, If-Modified-Since)
+// and range requests are handled for us.
+func (app *Application) serveSnippetContent(w http.ResponseWriter, r *http.Request, filename, content string, modified time.Time, download bool) {
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{
+		"filename": filename,
+	}))
+	w.Header().Set("ETag", models.ContentETag(content))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeContent(w, r, "", modified, strings.NewReader(content))
+}
+
+func (app *Application) DownloadSnippetArchive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		format, ok := archiveFormat(r)
+		if !ok {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		files, err := app.Snippets.Files(snippet)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
 			return
 		}
 
-		data := NewTemplateData[structs.SnippetStruct, models.Snippet](app, r, nil, structs.SnippetStruct{})
-		data.Data = snippet
+		// Put everything in a directory so extracting the archive doesn't
+		// spill files into the current one.
+		dir := fmt.Sprintf("snippet-%d", snippet.ID)
+		app.serveArchive(w, r, dir, format, snippetArchiveFiles(dir, snippet, files))
+	}
+}
+
+// archiveFormat returns the archive format asked for with the "format" query
+// parameter, zip when there is none, and whether it is one we can write.
+func archiveFormat(r *http.Request) (string, bool) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	_, ok := archive.Formats[format]
+	return format, ok
+}
+
+// snippetArchiveFiles lays out the files of a snippet in dir.
+func snippetArchiveFiles(dir string, snippet models.Snippet, files []models.SnippetFile) []archive.File {
+	entries := []archive.File{}
+	for i, f := range files {
+		entries = append(entries, archive.File{
+			Name:     dir + "/" + f.DisplayName(snippet.ID, i),
+			Content:  []byte(f.Content),
+			Modified: snippet.Updated,
+		})
+	}
+	return entries
+}
 
-		app.Render(w, r, http.StatusOK, "view.tmpl.html", data)
+// serveArchive sends entries as a download named after name.
+func (app *Application) serveArchive(w http.ResponseWriter, r *http.Request, name, format string, entries []archive.File) {
+	// Build the archive in memory first so a failure can still be
+	// reported with a proper status code.
+	buf := new(bytes.Buffer)
+	if err := archive.Write(buf, format, entries); err != nil {
+		app.InternalServerError(err)(w, r)
+		return
 	}
+
+	setArchiveHeaders(w, name, format)
+	buf.WriteTo(w)
+}
+
+// setArchiveHeaders makes the response a download of an archive named after
+// name.
+func setArchiveHeaders(w http.ResponseWriter, name, format string) {
+	w.Header().Set("Content-Type", archive.Formats[format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": name + "." + format,
+	}))
 }
 
 func (app *Application) GetAllSnippets() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		snippets, err := app.Snippets.Latest()
 		if err != nil {
-			app.InternalServerError(err)(w, r)
+			app.JSONInternalServerError(err)(w, r)
 			return
 		}
 
-		fmt.Fprintf(w, "%+v", snippets)
+		app.JSONSuccess(http.StatusOK, map[string]interface{}{"snippets": snippets})(w, r)
 	}
 }
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+	"strconv"
+)
+
+const (
+	apiDefaultPageSize = 20
+	apiMaxPageSize     = 100
+)
+
+// queryInt reads a non-negative integer query parameter, falling back to the
+// default when it is absent.
+func queryInt(r *http.Request, key string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%s must be a positive integer", key)
+	}
+
+	return i, nil
+}
+
+// apiSnippet loads the snippet named in the path and writes the error response
+// itself when it can't, in which case ok is false.
+func (app *Application) apiSnippet(w http.ResponseWriter, r *http.Request) (snippet models.Snippet, ok bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.JSONError(http.StatusNotFound, "The snippet could not be found", nil)(w, r)
+		return models.Snippet{}, false
+	}
+
+	snippet, err = app.Snippets.Get(id)
+	if err == nil && !app.canView(r, snippet) {
+		err = models.ErrNoRecord
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.JSONError(http.StatusNotFound, "The snippet could not be found", nil)(w, r)
+		} else {
+			app.JSONInternalServerError(err)(w, r)
+		}
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+// apiOwnedSnippet is apiSnippet for routes that change a snippet, which only
+// its owner may do.
+func (app *Application) apiOwnedSnippet(w http.ResponseWriter, r *http.Request) (models.Snippet, bool) {
+	snippet, ok := app.apiSnippet(w, r)
+	if !ok {
+		return models.Snippet{}, false
+	}
+
+	if snippet.UserID != app.CurrentUser(r).ID {
+		app.JSONError(http.StatusForbidden, "You can only change your own snippets", nil)(w, r)
+		return models.Snippet{}, false
+	}
+
+	return snippet, true
+}
+
+func (app *Application) APIListSnippets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := queryInt(r, "limit", apiDefaultPageSize)
+		if err == nil && (limit < 1 || limit > apiMaxPageSize) {
+			err = fmt.Errorf("limit must be between 1 and %d", apiMaxPageSize)
+		}
+		if err != nil {
+			app.JSONError(http.StatusBadRequest, err.Error(), nil)(w, r)
+			return
+		}
+
+		offset, err := queryInt(r, "offset", 0)
+		if err != nil {
+			app.JSONError(http.StatusBadRequest, err.Error(), nil)(w, r)
+			return
+		}
+
+		snippets, err := app.Snippets.List(limit, offset)
+		if err != nil {
+			app.JSONInternalServerError(err)(w, r)
+			return
+		}
+
+		app.JSONSuccess(http.StatusOK, map[string]interface{}{
+			"snippets": snippets,
+			"limit":    limit,
+			"offset":   offset,
+		})(w, r)
+	}
+}
+
+func (app *Application) APIGetSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.apiSnippet(w, r)
+		if !ok {
+			return
+		}
+
+		app.JSONSuccess(http.StatusOK, map[string]interface{}{"snippet": snippet})(w, r)
+	}
+}
+
+func (app *Application) APICreateSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form structs.SnippetStruct
+
+		err := app.DecodeJSON(w, r, &form)
+		if err != nil {
+			app.JSONError(http.StatusBadRequest, err.Error(), nil)(w, r)
+			return
+		}
+
+		form.Validate()
+
+		if !form.Valid() {
+			app.JSONValidationError(form.Validator)(w, r)
+			return
+		}
+
+		id, err := app.Snippets.Insert(app.CurrentUser(r).ID, form.Title, form.Content, form.Language,
+			form.VisibilityOr(models.VisibilityPublic), form.Expires)
+		if err != nil {
+			app.JSONInternalServerError(err)(w, r)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(id)
+		if err != nil {
+			app.JSONInternalServerError(err)(w, r)
+			return
+		}
+
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+		app.JSONSuccess(http.StatusCreated, map[string]interface{}{"snippet": snippet})(w, r)
+	}
+}
+
+func (app *Application) APIUpdateSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.apiOwnedSnippet(w, r)
+		if !ok {
+			return
+		}
+
+		var form structs.SnippetStruct
+
+		err := app.DecodeJSON(w, r, &form)
+		if err != nil {
+			app.JSONError(http.StatusBadRequest, err.Error(), nil)(w, r)
+			return
+		}
+
+		form.Validate()
+
+		if !form.Valid() {
+			app.JSONValidationError(form.Validator)(w, r)
+			return
+		}
+
+		err = app.Snippets.Update(snippet.ID, snippet.UserID, form.Title, form.Content, form.Language,
+			form.VisibilityOr(snippet.Visibility), form.Expires)
+		if err != nil {
+			app.JSONInternalServerError(err)(w, r)
+			return
+		}
+
+		snippet, err = app.Snippets.Get(snippet.ID)
+		if err != nil {
+			app.JSONInternalServerError(err)(w, r)
+			return
+		}
+
+		app.JSONSuccess(http.StatusOK, map[string]interface{}{"snippet": snippet})(w, r)
+	}
+}
+
+func (app *Application) APIDeleteSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.apiOwnedSnippet(w, r)
+		if !ok {
+			return
+		}
+
+		err := app.deleteSnippet(r.Context(), snippet)
+		if err != nil {
+			app.JSONInternalServerError(err)(w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (app *Application) APICurrentUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.JSONSuccess(http.StatusOK, map[string]interface{}{"user": app.CurrentUser(r)})(w, r)
+	}
+}
+
+func (app *Application) APINotFound() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.JSONError(http.StatusNotFound, "The requested resource could not be found", nil)(w, r)
+	}
+}
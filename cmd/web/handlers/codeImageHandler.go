@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"snippetbox/internal/codeimage"
+	"strconv"
+	"strings"
+)
+
+// GetSnippetImage serves /snippet/image/{id}.png, a picture of the code of a
+// snippet's file. ?file= picks the file like on the raw endpoint.
+func (app *Application) GetSnippetImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Wildcards match whole path segments, so the extension is checked
+		// and removed here.
+		id, ok := strings.CutSuffix(r.PathValue("id"), ".png")
+		if !ok {
+			app.NotFound(fmt.Errorf("invalid snippet image %q", r.PathValue("id")))(w, r)
+			return
+		}
+		r.SetPathValue("id", id)
+
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		files, err := app.Snippets.Files(snippet)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		name, content := "", ""
+		for i, f := range files {
+			if n := f.DisplayName(snippet.ID, i); r.URL.Query().Get("file") == "" || r.URL.Query().Get("file") == n {
+				name, content = n, f.Content
+				break
+			}
+		}
+		if name == "" {
+			app.NotFound(fmt.Errorf("snippet %d has no file %q", snippet.ID, r.URL.Query().Get("file")))(w, r)
+			return
+		}
+
+		// Images only depend on what they show, so identical files share a
+		// cached image and an entity tag.
+		sum := sha256.Sum256([]byte(codeimage.Version + "\x00" + name + "\x00" + content))
+		key := hex.EncodeToString(sum[:])
+		etag := `"` + key[:32] + `"`
+
+		// Only images of public snippets may sit in shared caches. Unlisted
+		// ones are meant for whoever has the link, not for every user of a
+		// proxy or CDN.
+		w.Header().Set("ETag", etag)
+		if snippet.IsPublic() {
+			w.Header().Set("Cache-Control", "public, max-age=300")
+		} else {
+			w.Header().Set("Cache-Control", "private, no-cache")
+		}
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		data, ok := app.CodeImages.Get(key)
+		if !ok {
+			var buf bytes.Buffer
+			if err = codeimage.Render(&buf, name, content); err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+			data = buf.Bytes()
+			app.CodeImages.Put(key, data)
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
+
+// GetSnippetCard serves /snippet/card/{id}.png, the preview image link
+// unfurls show for a public snippet. Other snippets have no card so that
+// nothing of them ends up in a crawler's cache.
+func (app *Application) GetSnippetCard() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := strings.CutSuffix(r.PathValue("id"), ".png")
+		if !ok {
+			app.NotFound(fmt.Errorf("invalid snippet card %q", r.PathValue("id")))(w, r)
+			return
+		}
+		r.SetPathValue("id", id)
+
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+		if !snippet.IsPublic() {
+			app.NotFound(fmt.Errorf("snippet %d is %s", snippet.ID, snippet.Visibility))(w, r)
+			return
+		}
+
+		sum := sha256.Sum256([]byte("card\x00" + codeimage.Version + "\x00" + snippet.Title + "\x00" + snippet.Content))
+		key := hex.EncodeToString(sum[:])
+		etag := `"` + key[:32] + `"`
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		data, ok := app.CodeImages.Get(key)
+		if !ok {
+			var buf bytes.Buffer
+			if err := codeimage.RenderCard(&buf, snippet.Title, snippet.Content); err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+			data = buf.Bytes()
+			app.CodeImages.Put(key, data)
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+	}
+}
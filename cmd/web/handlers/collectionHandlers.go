@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/archive"
+	"snippetbox/internal/markdown"
+	"snippetbox/internal/models"
+	"strconv"
+	"strings"
+)
+
+// collectionsPage is the data behind the list of the current user's
+// collections.
+type collectionsPage struct {
+	Collections []models.Collection
+}
+
+// collectionPage is the data behind a collection. Description is rendered
+// from the Markdown the owner wrote.
+type collectionPage struct {
+	Collection  models.Collection
+	Description template.HTML
+	Snippets    []snippetListItem
+	// Last is the index of the last snippet, which can't move down.
+	Last    int
+	IsOwner bool
+	// Editing keeps the settings form open after it failed validation.
+	Editing bool
+}
+
+// collectionFromPath loads the collection named by the "id" path value.
+// Collections the requester may not view are treated as missing.
+func (app *Application) collectionFromPath(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		app.NotFound(fmt.Errorf("invalid collection id %q", r.PathValue("id")))(w, r)
+		return models.Collection{}, false
+	}
+
+	collection, err := app.Collections.Get(id)
+	if err == nil && !collection.VisibleTo(app.viewerID(r)) {
+		err = models.ErrNoRecord
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(err)(w, r)
+		} else {
+			app.InternalServerError(err)(w, r)
+		}
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+// ownedCollectionFromPath is collectionFromPath for changes, which only the
+// owner of the collection may make.
+func (app *Application) ownedCollectionFromPath(w http.ResponseWriter, r *http.Request) (models.Collection, bool) {
+	collection, ok := app.collectionFromPath(w, r)
+	if !ok {
+		return models.Collection{}, false
+	}
+
+	if collection.UserID != app.CurrentUser(r).ID {
+		app.ClientError(http.StatusForbidden)(w, r)
+		return models.Collection{}, false
+	}
+
+	return collection, true
+}
+
+func (app *Application) renderUserCollections(w http.ResponseWriter, r *http.Request, status int, form *structs.CollectionStruct) {
+	collections, err := app.Collections.ForUser(app.CurrentUser(r).ID)
+	if err != nil {
+		app.InternalServerError(err)(w, r)
+		return
+	}
+
+	data := NewTemplateData[structs.CollectionStruct, collectionsPage](app, r, form, structs.CollectionStruct{})
+	data.Data.Collections = collections
+
+	app.Render(w, r, status, "collections.tmpl.html", data)
+}
+
+// GetUserCollections lists the current user's collections above a form to
+// create another.
+func (app *Application) GetUserCollections() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.renderUserCollections(w, r, http.StatusOK, nil)
+	}
+}
+
+func (app *Application) PostCreateCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form structs.CollectionStruct
+		if err := app.DecodePostForm(r, &form); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		form.Validate()
+		if !form.Valid() {
+			app.renderUserCollections(w, r, http.StatusUnprocessableEntity, &form)
+			return
+		}
+
+		id, err := app.Collections.Insert(app.CurrentUser(r).ID, strings.TrimSpace(form.Name), form.Description, form.Visibility)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "Collection created. Add snippets to it from their pages.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/collection/%d", id), http.StatusSeeOther)
+	}
+}
+
+func (app *Application) renderCollection(w http.ResponseWriter, r *http.Request, status int, collection models.Collection, form *structs.CollectionStruct) {
+	snippets, err := app.Snippets.InCollection(collection.ID, app.viewerID(r))
+	if err != nil {
+		app.InternalServerError(err)(w, r)
+		return
+	}
+
+	items, err := app.newSnippetListItems(snippets)
+	if err != nil {
+		app.InternalServerError(err)(w, r)
+		return
+	}
+
+	if form == nil {
+		form = &structs.CollectionStruct{
+			Name:        collection.Name,
+			Description: collection.Description,
+			Visibility:  collection.Visibility,
+		}
+	}
+
+	data := NewTemplateData[structs.CollectionStruct, collectionPage](app, r, form, structs.CollectionStruct{})
+	data.Data = collectionPage{
+		Collection:  collection,
+		Description: markdown.Comment(collection.Description),
+		Snippets:    items,
+		Last:        len(items) - 1,
+		IsOwner:     collection.UserID == app.viewerID(r),
+		Editing:     status == http.StatusUnprocessableEntity,
+	}
+	data.Meta.URL = absoluteURL(r, fmt.Sprintf("/snippet/collection/%d", collection.ID))
+	if collection.IsPublic() {
+		data.Meta.Title = collection.Name
+		if description := strings.Join(strings.Fields(collection.Description), " "); description != "" {
+			if runes := []rune(description); len(runes) > maxMetaDescription {
+				description = string(runes[:maxMetaDescription-1]) + "…"
+			}
+			data.Meta.Description = description
+		}
+	} else {
+		data.Meta.NoIndex = true
+	}
+
+	app.Render(w, r, status, "collection.tmpl.html", data)
+}
+
+// GetCollection shows the snippets of a collection in their order. Viewers
+// only see the snippets they could open on their own.
+func (app *Application) GetCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := app.collectionFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		app.renderCollection(w, r, http.StatusOK, collection, nil)
+	}
+}
+
+func (app *Application) PostEditCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := app.ownedCollectionFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		var form structs.CollectionStruct
+		if err := app.DecodePostForm(r, &form); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		form.Validate()
+		if !form.Valid() {
+			app.renderCollection(w, r, http.StatusUnprocessableEntity, collection, &form)
+			return
+		}
+
+		err := app.Collections.Update(collection.ID, collection.UserID, strings.TrimSpace(form.Name), form.Description, form.Visibility)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "Collection updated.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/collection/%d", collection.ID), http.StatusSeeOther)
+	}
+}
+
+func (app *Application) DeleteCollection() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := app.ownedCollectionFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		err := app.Collections.Delete(collection.ID, collection.UserID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", fmt.Sprintf("Collection %q deleted. Its snippets are still there.", collection.Name))
+		http.Redirect(w, r, "/user/collections", http.StatusSeeOther)
+	}
+}
+
+// PostCollectionSnippet moves a snippet up or down in a collection, or
+// removes it, depending on the action posted.
+func (app *Application) PostCollectionSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := app.ownedCollectionFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		snippetID, err := strconv.Atoi(r.PostForm.Get("snippet"))
+		if err != nil || snippetID < 1 {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		back := fmt.Sprintf("/snippet/collection/%d", collection.ID)
+		switch r.PostForm.Get("action") {
+		case "up":
+			err = app.Collections.MoveSnippet(collection.ID, collection.UserID, snippetID, true)
+			back += fmt.Sprintf("#snippet-%d", snippetID)
+		case "down":
+			err = app.Collections.MoveSnippet(collection.ID, collection.UserID, snippetID, false)
+			back += fmt.Sprintf("#snippet-%d", snippetID)
+		case "remove":
+			err = app.Collections.RemoveSnippet(collection.ID, collection.UserID, snippetID)
+			if err == nil {
+				app.SessionManager.Put(r.Context(), "flash", "Snippet removed from the collection.")
+			}
+		default:
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+// PostCollectSnippet adds a snippet to the end of one of the current user's
+// collections, from the snippet's page.
+func (app *Application) PostCollectSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		back := fmt.Sprintf("/snippet/view/%d", snippet.ID)
+
+		id, err := strconv.Atoi(r.PostForm.Get("collection"))
+		if err != nil || id < 1 {
+			app.SessionManager.Put(r.Context(), "flash", "Choose a collection to add the snippet to.")
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		collection, err := app.Collections.Get(id)
+		if err == nil && collection.UserID != app.CurrentUser(r).ID {
+			err = models.ErrNoRecord
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		err = app.Collections.AddSnippet(collection.ID, collection.UserID, snippet.ID)
+		if errors.Is(err, models.ErrCollectionFull) {
+			app.SessionManager.Put(r.Context(), "flash",
+				fmt.Sprintf("A collection can hold at most %d snippets.", models.MaxCollectionSnippets))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", fmt.Sprintf("Added to %q.", collection.Name))
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+// DownloadCollectionArchive serves every snippet of a collection the
+// requester can see as a zip or tar.gz archive. Each snippet gets its own
+// directory, numbered to keep the collection's order, and a README lists
+// them with the collection's description.
+//
+// A collection can add up to a lot of content, so the archive is streamed a
+// snippet at a time instead of being built in memory first. An error after
+// the first byte can only cut the download short.
+func (app *Application) DownloadCollectionArchive() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collection, ok := app.collectionFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		format, ok := archiveFormat(r)
+		if !ok {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		snippets, err := app.Snippets.InCollection(collection.ID, app.viewerID(r))
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		dir := fmt.Sprintf("collection-%d", collection.ID)
+		width := len(strconv.Itoa(len(snippets)))
+		names := make([]string, len(snippets))
+
+		readme := new(strings.Builder)
+		fmt.Fprintf(readme, "# %s\n\n", collection.Name)
+		if description := strings.TrimSpace(collection.Description); description != "" {
+			fmt.Fprintf(readme, "%s\n\n", description)
+		}
+		for i, snippet := range snippets {
+			names[i] = fmt.Sprintf("%0*d-snippet-%d", width, i+1, snippet.ID)
+			fmt.Fprintf(readme, "%d. [%s](%s/) - %s\n", i+1, snippet.Title, names[i],
+				absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID)))
+		}
+
+		setArchiveHeaders(w, dir, format)
+		aw := archive.NewWriter(w, format)
+		err = aw.Add(archive.File{Name: dir + "/README.md", Content: []byte(readme.String()), Modified: collection.Updated})
+
+		for i := 0; err == nil && i < len(snippets); i++ {
+			var files []models.SnippetFile
+			files, err = app.Snippets.Files(snippets[i])
+			if err != nil {
+				break
+			}
+			for _, entry := range snippetArchiveFiles(dir+"/"+names[i], snippets[i], files) {
+				if err = aw.Add(entry); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = aw.Close()
+		}
+
+		if err != nil {
+			app.Logger.Error("Failed to stream a collection archive", "collection", collection.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+	"strings"
+)
+
+// lineThread is a review comment with its replies.
+type lineThread struct {
+	models.LineComment
+	Replies []models.LineComment
+	// CanReply is set when the viewer may add to the thread.
+	CanReply bool
+}
+
+// newLineThreads groups review comments into threads, those on the current
+// revision keyed by file name and the outdated ones apart.
+func newLineThreads(comments []models.LineComment, canReply bool) (byFile map[string][]*lineThread, outdated []*lineThread) {
+	byFile = map[string][]*lineThread{}
+	threads := map[int]*lineThread{}
+
+	for _, c := range comments {
+		if c.ThreadID != 0 {
+			if t, ok := threads[c.ThreadID]; ok {
+				t.Replies = append(t.Replies, c)
+			}
+			continue
+		}
+
+		t := &lineThread{LineComment: c, CanReply: canReply}
+		threads[c.ID] = t
+		if c.Outdated {
+			outdated = append(outdated, t)
+		} else {
+			byFile[c.Filename] = append(byFile[c.Filename], t)
+		}
+	}
+
+	return byFile, outdated
+}
+
+// fieldErrorsMessage puts the errors of a form that is shown on another page
+// into one line for a flash message.
+func fieldErrorsMessage(fieldErrors map[string]string) string {
+	messages := []string{}
+	for field, message := range fieldErrors {
+		if message != "" {
+			messages = append(messages, field+": "+message)
+		}
+	}
+	slices.Sort(messages)
+
+	return strings.Join(messages, ". ") + "."
+}
+
+// PostLineComment starts a review thread on lines of a snippet file, or
+// replies to one.
+func (app *Application) PostLineComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		back := fmt.Sprintf("/snippet/view/%d", snippet.ID)
+
+		var form structs.LineCommentStruct
+		if err := app.DecodePostForm(r, &form); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		form.Validate()
+		if !form.Valid() {
+			app.SessionManager.Put(r.Context(), "flash", fieldErrorsMessage(form.FieldErrors))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		userID := app.CurrentUser(r).ID
+
+		var id int
+		var err error
+		if form.Thread != 0 {
+			id, err = app.LineComments.Reply(snippet.ID, form.Thread, userID, form.Body)
+		} else {
+			id, err = app.startLineThread(snippet, userID, &form)
+		}
+		if err != nil {
+			var message flashError
+			switch {
+			case errors.Is(err, models.ErrNoRecord):
+				app.NotFound(err)(w, r)
+			case errors.As(err, &message):
+				app.SessionManager.Put(r.Context(), "flash", string(message))
+				http.Redirect(w, r, back, http.StatusSeeOther)
+			default:
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "Comment added.")
+		http.Redirect(w, r, fmt.Sprintf("%s#comment-%d", back, id), http.StatusSeeOther)
+	}
+}
+
+// flashError is an error the user can fix, shown as is.
+type flashError string
+
+func (e flashError) Error() string {
+	return string(e)
+}
+
+// startLineThread checks the commented lines against the snippet as it is
+// now and stores the first comment of a thread on them.
+func (app *Application) startLineThread(snippet models.Snippet, userID int, form *structs.LineCommentStruct) (int, error) {
+	files, err := app.Snippets.Files(snippet)
+	if err != nil {
+		return 0, err
+	}
+
+	i := len(files) - 1
+	for ; i >= 0; i-- {
+		if files[i].DisplayName(snippet.ID, i) == form.File {
+			break
+		}
+	}
+	if i < 0 {
+		return 0, flashError(fmt.Sprintf("The snippet has no file named %s.", form.File))
+	}
+
+	start, end, _ := form.Range()
+	lines := models.SplitLines(files[i].Content)
+	if end > len(lines) {
+		return 0, flashError(fmt.Sprintf("%s only has %d lines.", form.File, len(lines)))
+	}
+
+	return app.LineComments.Insert(snippet.ID, userID, form.File, start, end,
+		strings.Join(lines[start-1:end], "\n"), form.Body)
+}
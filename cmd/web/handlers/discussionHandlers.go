@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/markdown"
+	"snippetbox/internal/models"
+	"snippetbox/internal/moderation"
+	"strconv"
+)
+
+// commentView is a discussion comment ready to show.
+type commentView struct {
+	models.Comment
+	HTML     template.HTML
+	IsAuthor bool
+}
+
+func newCommentViews(comments []models.Comment, viewerID int) []commentView {
+	views := []commentView{}
+	for _, c := range comments {
+		views = append(views, commentView{
+			Comment:  c,
+			HTML:     markdown.Comment(c.Body),
+			IsAuthor: c.UserID == viewerID,
+		})
+	}
+	return views
+}
+
+// commentPage is the data behind the comment edit page.
+type commentPage struct {
+	Snippet models.Snippet
+	Comment models.Comment
+}
+
+// commentFromPath loads the comment named by the {comment} path value of a
+// snippet.
+func (app *Application) commentFromPath(w http.ResponseWriter, r *http.Request, snippet models.Snippet) (models.Comment, bool) {
+	id, err := strconv.Atoi(r.PathValue("comment"))
+	if err != nil || id < 1 {
+		app.NotFound(fmt.Errorf("invalid comment id %q", r.PathValue("comment")))(w, r)
+		return models.Comment{}, false
+	}
+
+	comment, err := app.Comments.Get(id, snippet.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.NotFound(err)(w, r)
+		} else {
+			app.InternalServerError(err)(w, r)
+		}
+		return models.Comment{}, false
+	}
+
+	return comment, true
+}
+
+// ownCommentFromPath is commentFromPath for changes only the author may make.
+func (app *Application) ownCommentFromPath(w http.ResponseWriter, r *http.Request, snippet models.Snippet) (models.Comment, bool) {
+	comment, ok := app.commentFromPath(w, r, snippet)
+	if ok && comment.UserID != app.CurrentUser(r).ID {
+		app.NotFound(fmt.Errorf("comment %d isn't by user %d", comment.ID, app.CurrentUser(r).ID))(w, r)
+		return models.Comment{}, false
+	}
+	return comment, ok
+}
+
+// moderate runs a comment through the moderation hooks and returns the status
+// to store it with. A rejection comes back as a flashError. Snippet owners
+// moderate their own discussions, so nothing of theirs is held back.
+func (app *Application) moderate(r *http.Request, snippet models.Snippet, body string, edit bool) (string, error) {
+	userID := app.CurrentUser(r).ID
+
+	verdict, reason, err := app.Moderation.Review(r.Context(), moderation.Submission{
+		SnippetID: snippet.ID,
+		UserID:    userID,
+		Body:      body,
+		Edit:      edit,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case verdict == moderation.Reject:
+		return "", flashError(reason)
+	case verdict == moderation.Hold && userID != snippet.UserID:
+		app.Logger.Info("comment held for moderation", "snippet", snippet.ID, "user", userID, "reason", reason)
+		return models.CommentPending, nil
+	}
+
+	return models.CommentPublished, nil
+}
+
+// commentFlash is the message shown after a comment is stored.
+func commentFlash(status, done string) string {
+	if status == models.CommentPending {
+		return "Your comment will be shown once the snippet owner approves it."
+	}
+	return done
+}
+
+func (app *Application) PostComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		back := fmt.Sprintf("/snippet/view/%d#discussion", snippet.ID)
+
+		var form structs.CommentStruct
+		if err := app.DecodePostForm(r, &form); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		form.Validate()
+		if !form.Valid() {
+			app.SessionManager.Put(r.Context(), "flash", fieldErrorsMessage(form.FieldErrors))
+			http.Redirect(w, r, back, http.StatusSeeOther)
+			return
+		}
+
+		status, err := app.moderate(r, snippet, form.Body, false)
+		var id int
+		if err == nil {
+			id, err = app.Comments.Insert(snippet.ID, app.CurrentUser(r).ID, form.Body, status)
+		}
+		if err != nil {
+			var message flashError
+			if errors.As(err, &message) {
+				app.SessionManager.Put(r.Context(), "flash", string(message))
+				http.Redirect(w, r, back, http.StatusSeeOther)
+				return
+			}
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", commentFlash(status, "Comment added."))
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#discussion-%d", snippet.ID, id), http.StatusSeeOther)
+	}
+}
+
+func (app *Application) renderEditComment(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet, comment models.Comment, form *structs.CommentStruct) {
+	data := NewTemplateData[structs.CommentStruct, commentPage](app, r, form, structs.CommentStruct{})
+	data.Data = commentPage{Snippet: snippet, Comment: comment}
+	data.Meta.NoIndex = true
+
+	app.Render(w, r, status, "comment.tmpl.html", data)
+}
+
+func (app *Application) GetEditComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		comment, ok := app.ownCommentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+
+		app.renderEditComment(w, r, http.StatusOK, snippet, comment, &structs.CommentStruct{Body: comment.Body})
+	}
+}
+
+func (app *Application) PostEditComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		comment, ok := app.ownCommentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+
+		var form structs.CommentStruct
+		if err := app.DecodePostForm(r, &form); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		form.Validate()
+
+		status, err := "", error(nil)
+		if form.Valid() {
+			status, err = app.moderate(r, snippet, form.Body, true)
+			var message flashError
+			if errors.As(err, &message) {
+				form.AddFieldError("Body", string(message))
+				err = nil
+			}
+		}
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+		if !form.Valid() {
+			app.renderEditComment(w, r, http.StatusUnprocessableEntity, snippet, comment, &form)
+			return
+		}
+
+		if err = app.Comments.Update(comment.ID, snippet.ID, comment.UserID, form.Body, status); err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", commentFlash(status, "Comment updated."))
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#discussion-%d", snippet.ID, comment.ID), http.StatusSeeOther)
+	}
+}
+
+func (app *Application) DeleteComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		comment, ok := app.ownCommentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+
+		if err := app.Comments.Delete(comment.ID, snippet.ID, comment.UserID); err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "Comment deleted.")
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#discussion", snippet.ID), http.StatusSeeOther)
+	}
+}
+
+// commentActions maps the moderation actions open to snippet owners to the
+// status they give a comment.
+var commentActions = map[string]string{
+	"approve": models.CommentPublished,
+	"hide":    models.CommentHidden,
+	"unhide":  models.CommentPublished,
+}
+
+// ModerateComment lets the owner of a snippet approve held comments in its
+// discussion and hide or unhide any of them.
+func (app *Application) ModerateComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.ownedSnippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		comment, ok := app.commentFromPath(w, r, snippet)
+		if !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		status, ok := commentActions[r.PostForm.Get("action")]
+		if !ok {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		if err := app.Comments.SetStatus(comment.ID, snippet.ID, status); err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.Logger.Info("comment moderated", "snippet", snippet.ID, "comment", comment.ID, "action", r.PostForm.Get("action"))
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d#discussion-%d", snippet.ID, comment.ID), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"snippetbox/internal/openapi"
+)
+
+// apiDocsPage is the data behind the API documentation page.
+type apiDocsPage struct {
+	Info      openapi.Info
+	Endpoints []openapi.Endpoint
+	Schemas   map[string]openapi.Schema
+}
+
+func (app *Application) GetOpenAPISpec() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(app.APISpec.Raw)
+	}
+}
+
+func (app *Application) GetAPIDocs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := NewTemplateData[struct{}, apiDocsPage](app, r, nil, struct{}{})
+		data.Data = apiDocsPage{
+			Info:      app.APISpec.Info,
+			Endpoints: app.APISpec.Endpoints(),
+			Schemas:   app.APISpec.Components.Schemas,
+		}
+
+		app.Render(w, r, http.StatusOK, "docs.tmpl.html", data)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Embeds are cached for a few minutes, never past the snippet's expiry.
+const maxEmbedAge = 5 * time.Minute
+
+// Default and largest sizes of the iframe offered over oEmbed, in pixels.
+const (
+	embedWidth     = 640
+	embedMinHeight = 120
+	embedMaxHeight = 480
+	embedLine      = 27
+)
+
+// embedCacheControl lets caches keep an embed until the snippet expires, but
+// not longer than maxEmbedAge.
+func embedCacheControl(snippet models.Snippet) string {
+	age := min(time.Until(snippet.Expires), maxEmbedAge)
+	return "public, max-age=" + strconv.Itoa(max(int(age.Seconds()), 0))
+}
+
+// GetSnippetEmbed serves /snippet/embed/{id}, the snippet without the site
+// around it, for iframes on other sites. Private snippets can't be embedded,
+// the owner's session cookie isn't sent to a third party frame anyway.
+func (app *Application) GetSnippetEmbed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+		if snippet.Visibility == models.VisibilityPrivate {
+			app.NotFound(fmt.Errorf("snippet %d is private", snippet.ID))(w, r)
+			return
+		}
+
+		files, err := app.Snippets.Files(snippet)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		attachments, err := app.Attachments.ForSnippet(snippet.ID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		var images []models.Attachment
+		for _, a := range attachments {
+			if a.IsImage() {
+				images = append(images, a)
+			}
+		}
+
+		data := NewTemplateData[structs.SnippetStruct, snippetPage](app, r, nil, structs.SnippetStruct{})
+		data.Data = snippetPage{
+			Snippet: snippet,
+			Files:   newSnippetFileViews(snippet, files, false),
+			Images:  images,
+		}
+		data.Meta = snippetMeta(r, snippet, images, data.Meta)
+		data.Meta.NoIndex = true
+
+		w.Header().Set("Cache-Control", embedCacheControl(snippet))
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		app.Render(w, r, http.StatusOK, "embed.tmpl.html", data)
+	}
+}
+
+// oEmbedResponse is a "rich" oEmbed response, see https://oembed.com.
+type oEmbedResponse struct {
+	Version      string `json:"version"`
+	Type         string `json:"type"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	Title        string `json:"title"`
+	CacheAge     int    `json:"cache_age"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// oEmbedSnippetID returns the id of the snippet a URL on this site points at,
+// be it its view or its embed page.
+func oEmbedSnippetID(r *http.Request, raw string) (int, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host != r.Host || (u.Scheme != "http" && u.Scheme != "https") {
+		return 0, false
+	}
+
+	for _, prefix := range []string{"/snippet/view/", "/snippet/embed/"} {
+		if rest, ok := strings.CutPrefix(u.Path, prefix); ok {
+			id, err := strconv.Atoi(rest)
+			return id, err == nil && id > 0
+		}
+	}
+
+	return 0, false
+}
+
+// GetOEmbed serves /oembed?url=, which sites that support oEmbed ask how to
+// embed a link to a snippet. Only public snippets are offered: an unfurl
+// would otherwise show an unlisted snippet to everyone a link was posted to.
+func (app *Application) GetOEmbed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if format := query.Get("format"); format != "" && format != "json" {
+			app.ClientError(http.StatusNotImplemented)(w, r)
+			return
+		}
+
+		id, ok := oEmbedSnippetID(r, query.Get("url"))
+		if !ok {
+			app.NotFound(fmt.Errorf("no snippet at %q", query.Get("url")))(w, r)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(id)
+		if err == nil && !snippet.IsPublic() {
+			err = models.ErrNoRecord
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		files, err := app.Snippets.Files(snippet)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		// The frame is sized to fit the code of every file where the consumer
+		// allows it. The minimum height holds the first line of the first
+		// file; each further file adds its header and first line.
+		lines := 2 * max(len(files)-1, 0)
+		for _, f := range files {
+			lines += strings.Count(f.Content, "\n")
+		}
+		width, height := embedWidth, embedMinHeight+embedLine*lines
+		if n, err := strconv.Atoi(query.Get("maxwidth")); err == nil && n > 0 {
+			width = min(width, n)
+		}
+		maxHeight := embedMaxHeight
+		if n, err := strconv.Atoi(query.Get("maxheight")); err == nil && n > 0 {
+			maxHeight = min(maxHeight, n)
+		}
+		height = min(height, maxHeight)
+
+		src := absoluteURL(r, fmt.Sprintf("/snippet/embed/%d", snippet.ID))
+		response := oEmbedResponse{
+			Version:      "1.0",
+			Type:         "rich",
+			ProviderName: "Snippetbox",
+			ProviderURL:  absoluteURL(r, "/"),
+			Title:        snippet.Title,
+			CacheAge:     int(maxEmbedAge.Seconds()),
+			HTML: fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" title="%s" style="border:0" loading="lazy"></iframe>`,
+				src, width, height, html.EscapeString(snippet.Title)),
+			Width:  width,
+			Height: height,
+		}
+
+		w.Header().Set("Cache-Control", embedCacheControl(snippet))
+		// oEmbed consumers expect the bare object, not the API envelope.
+		app.WriteJSON(w, r, http.StatusOK, response)
+	}
+}
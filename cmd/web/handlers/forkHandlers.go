@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/diff"
+	"snippetbox/internal/models"
+	"strconv"
+)
+
+// diffContext is how many unchanged lines are shown around each change.
+const diffContext = 3
+
+// comparePage is the data behind the page comparing a fork with its parent.
+type comparePage struct {
+	Fork   models.Snippet
+	Parent models.Snippet
+	Files  []fileDiff
+	// Additions and Deletions are the totals over every file.
+	Additions int
+	Deletions int
+}
+
+// fileDiff is one file of a fork compared with the same file of its parent.
+type fileDiff struct {
+	Name string
+	// Status is "added", "removed", "modified" or "unchanged".
+	Status    string
+	Hunks     []diff.Hunk
+	Additions int
+	Deletions int
+}
+
+// fileKey pairs up the files of a fork and its parent. Named files are
+// matched by name and unnamed ones by position, since their generated names
+// contain the snippet id.
+func fileKey(f models.SnippetFile, position int) string {
+	if f.Filename != "" {
+		return f.Filename
+	}
+	return "\x00" + strconv.Itoa(position)
+}
+
+// diffFiles compares the files of a fork with those of its parent, in the
+// order of the fork with files only the parent has last.
+func diffFiles(parent, fork models.Snippet, parentFiles, forkFiles []models.SnippetFile) []fileDiff {
+	before := map[string]models.SnippetFile{}
+	for i, f := range parentFiles {
+		before[fileKey(f, i)] = f
+	}
+
+	diffs := []fileDiff{}
+	compare := func(name, status string, a, b []string) {
+		lines := diff.Lines(a, b)
+		d := fileDiff{Name: name, Status: status, Hunks: diff.Hunks(lines, diffContext)}
+		d.Additions, d.Deletions = diff.Stats(lines)
+		if status == "modified" && len(d.Hunks) == 0 {
+			d.Status = "unchanged"
+		}
+		diffs = append(diffs, d)
+	}
+
+	for i, f := range forkFiles {
+		key := fileKey(f, i)
+		old, ok := before[key]
+		if !ok {
+			compare(f.DisplayName(fork.ID, i), "added", nil, models.SplitLines(f.Content))
+			continue
+		}
+		delete(before, key)
+		compare(f.DisplayName(fork.ID, i), "modified", models.SplitLines(old.Content), models.SplitLines(f.Content))
+	}
+
+	for i, f := range parentFiles {
+		if _, ok := before[fileKey(f, i)]; ok {
+			compare(f.DisplayName(parent.ID, i), "removed", models.SplitLines(f.Content), nil)
+		}
+	}
+
+	return diffs
+}
+
+// PostForkSnippet copies a snippet into the account of the current user and
+// shows the copy.
+func (app *Application) PostForkSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := app.Snippets.Fork(snippet, app.CurrentUser(r).ID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", fmt.Sprintf("Forked from snippet #%d.", snippet.ID))
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+	}
+}
+
+// GetSnippetCompare shows what a fork changed from its parent as a diff.
+func (app *Application) GetSnippetCompare() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fork, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+		if fork.ForkedFrom == 0 {
+			app.NotFound(fmt.Errorf("snippet %d is not a fork", fork.ID))(w, r)
+			return
+		}
+
+		parent, err := app.Snippets.Get(fork.ForkedFrom)
+		if err == nil && !app.canView(r, parent) {
+			err = models.ErrNoRecord
+		}
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		parentFiles, err := app.Snippets.Files(parent)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		forkFiles, err := app.Snippets.Files(fork)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		page := comparePage{Fork: fork, Parent: parent, Files: diffFiles(parent, fork, parentFiles, forkFiles)}
+		for _, f := range page.Files {
+			page.Additions += f.Additions
+			page.Deletions += f.Deletions
+		}
+
+		data := NewTemplateData[structs.SnippetStruct, comparePage](app, r, nil, structs.SnippetStruct{})
+		data.Data = page
+		data.Meta = snippetMeta(r, fork, nil, data.Meta)
+
+		app.Render(w, r, http.StatusOK, "compare.tmpl.html", data)
+	}
+}
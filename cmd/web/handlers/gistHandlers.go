@@ -0,0 +1,741 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The gist routes mirror the subset of the GitHub Gist REST API that gist
+// command line tools and editor plugins use, so those clients can be pointed
+// at this server by changing their base URL. Responses use GitHub's shapes,
+// not the constants.SuccessResponse envelope of /api/v1.
+
+const (
+	gistDefaultPageSize = 30
+	gistMaxPageSize     = 100
+	// Gists don't expire on GitHub, so they get the longest expiry the
+	// snippet form allows, renewed on every update.
+	gistExpires = 365
+	// maxGistBytes caps the size of a gist request body.
+	maxGistBytes = 10 << 20
+	// maxGistTitle is the longest snippet title, in characters.
+	maxGistTitle = 100
+)
+
+type gistOwner struct {
+	Login string `json:"login"`
+	ID    int    `json:"id"`
+	Type  string `json:"type"`
+}
+
+type gistFile struct {
+	Filename  string  `json:"filename"`
+	Type      string  `json:"type"`
+	Language  *string `json:"language"`
+	RawURL    string  `json:"raw_url"`
+	Size      int     `json:"size"`
+	Truncated bool    `json:"truncated"`
+	Content   string  `json:"content,omitempty"`
+}
+
+type gistChangeStatus struct {
+	Total     int `json:"total"`
+	Additions int `json:"additions"`
+	Deletions int `json:"deletions"`
+}
+
+type gistHistory struct {
+	URL          string           `json:"url"`
+	Version      string           `json:"version"`
+	User         *gistOwner       `json:"user"`
+	ChangeStatus gistChangeStatus `json:"change_status"`
+	CommittedAt  time.Time        `json:"committed_at"`
+}
+
+type gist struct {
+	URL         string              `json:"url"`
+	ForksURL    string              `json:"forks_url"`
+	CommitsURL  string              `json:"commits_url"`
+	ID          string              `json:"id"`
+	HTMLURL     string              `json:"html_url"`
+	Files       map[string]gistFile `json:"files"`
+	Public      bool                `json:"public"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+	Description string              `json:"description"`
+	Comments    int                 `json:"comments"`
+	User        *gistOwner          `json:"user"`
+	Owner       *gistOwner          `json:"owner,omitempty"`
+	Truncated   bool                `json:"truncated"`
+	History     []gistHistory       `json:"history,omitempty"`
+}
+
+type gistError struct {
+	Resource string `json:"resource"`
+	Field    string `json:"field"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// gistErrorResponse writes an error body in GitHub's format.
+func (app *Application) gistErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string, errs []gistError) {
+	body := map[string]any{
+		"message":           message,
+		"documentation_url": absoluteURL(r, "/api/docs"),
+	}
+	if len(errs) > 0 {
+		body["errors"] = errs
+	}
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+
+	app.WriteJSON(w, r, status, body)
+}
+
+func (app *Application) gistServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.Logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.gistErrorResponse(w, r, http.StatusInternalServerError, "Server Error", nil)
+}
+
+// gistRequireScope writes an error and returns false unless the request
+// carries an API token with the scope.
+func (app *Application) gistRequireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if app.APIToken(r) == nil {
+		app.gistErrorResponse(w, r, http.StatusUnauthorized, "Requires authentication", nil)
+		return false
+	}
+
+	if !app.HasScope(r, scope) {
+		app.gistErrorResponse(w, r, http.StatusForbidden, fmt.Sprintf("Token is missing the %q scope", scope), nil)
+		return false
+	}
+
+	return true
+}
+
+// gistSnippet loads the snippet behind the {id} of the path. With owned set
+// it also has to belong to the current user; GitHub answers 404 rather than
+// 403 for other people's gists, and so do we. Reads with an API token need
+// the snippets:read scope, like listing the token owner's gists does.
+func (app *Application) gistSnippet(w http.ResponseWriter, r *http.Request, owned bool) (models.Snippet, bool) {
+	if !owned && app.APIToken(r) != nil && !app.gistRequireScope(w, r, models.ScopeSnippetsRead) {
+		return models.Snippet{}, false
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err == nil && id > 0 {
+		var snippet models.Snippet
+		snippet, err = app.Snippets.Get(id)
+		if err == nil && app.canView(r, snippet) && (!owned || snippet.UserID == app.CurrentUser(r).ID) {
+			return snippet, true
+		}
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.gistServerError(w, r, err)
+			return models.Snippet{}, false
+		}
+	}
+
+	app.gistErrorResponse(w, r, http.StatusNotFound, "Not Found", nil)
+	return models.Snippet{}, false
+}
+
+// gistOwners caches the users looked up while building one response.
+type gistOwners map[int]*gistOwner
+
+func (app *Application) gistOwner(owners gistOwners, userID int) (*gistOwner, error) {
+	if userID == 0 {
+		return nil, nil
+	}
+	if owner, ok := owners[userID]; ok {
+		return owner, nil
+	}
+
+	user, err := app.Users.Get(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			owners[userID] = nil
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	login := user.Username
+	if login == "" {
+		login = user.Name
+	}
+	owners[userID] = &gistOwner{Login: login, ID: user.ID, Type: "User"}
+
+	return owners[userID], nil
+}
+
+// newGist converts a snippet and the given version of its files to GitHub's
+// representation. Content is only included when full is set, as GitHub does
+// for single gists but not for listings.
+func (app *Application) newGist(r *http.Request, owners gistOwners, snippet models.Snippet, files []models.SnippetFile, version string, full bool) (gist, error) {
+	owner, err := app.gistOwner(owners, snippet.UserID)
+	if err != nil {
+		return gist{}, err
+	}
+
+	g := gist{
+		URL:         absoluteURL(r, fmt.Sprintf("/gists/%d", snippet.ID)),
+		ForksURL:    absoluteURL(r, fmt.Sprintf("/gists/%d/forks", snippet.ID)),
+		CommitsURL:  absoluteURL(r, fmt.Sprintf("/gists/%d/commits", snippet.ID)),
+		ID:          strconv.Itoa(snippet.ID),
+		HTMLURL:     absoluteURL(r, fmt.Sprintf("/snippet/view/%d", snippet.ID)),
+		Files:       map[string]gistFile{},
+		Public:      snippet.IsPublic(),
+		CreatedAt:   snippet.Created,
+		UpdatedAt:   snippet.Updated,
+		Description: snippet.Title,
+		Owner:       owner,
+	}
+
+	for i, f := range files {
+		name := f.DisplayName(snippet.ID, i)
+
+		raw := url.Values{"file": {name}}
+		if version != "" {
+			raw.Set("version", version)
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "text/plain"
+		}
+
+		file := gistFile{
+			Filename: name,
+			Type:     contentType,
+			RawURL:   absoluteURL(r, fmt.Sprintf("/snippet/raw/%d?%s", snippet.ID, raw.Encode())),
+			Size:     len(f.Content),
+		}
+		if f.Language != "" {
+			file.Language = &f.Language
+		}
+		if full {
+			file.Content = f.Content
+		}
+		g.Files[name] = file
+	}
+
+	return g, nil
+}
+
+func (app *Application) newGistHistory(r *http.Request, owners gistOwners, revisions []models.Revision) ([]gistHistory, error) {
+	history := []gistHistory{}
+	for _, revision := range revisions {
+		user, err := app.gistOwner(owners, revision.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		history = append(history, gistHistory{
+			URL:     absoluteURL(r, fmt.Sprintf("/gists/%d/%s", revision.SnippetID, revision.Version)),
+			Version: revision.Version,
+			User:    user,
+			ChangeStatus: gistChangeStatus{
+				Total:     revision.Additions + revision.Deletions,
+				Additions: revision.Additions,
+				Deletions: revision.Deletions,
+			},
+			CommittedAt: revision.Committed,
+		})
+	}
+
+	return history, nil
+}
+
+// writeGist writes the current state of a snippet with its files and history.
+func (app *Application) writeGist(w http.ResponseWriter, r *http.Request, status int, snippet models.Snippet) {
+	files, err := app.Snippets.Files(snippet)
+	if err != nil {
+		app.gistServerError(w, r, err)
+		return
+	}
+
+	revisions, err := app.Snippets.Revisions(snippet.ID)
+	if err != nil {
+		app.gistServerError(w, r, err)
+		return
+	}
+
+	owners := gistOwners{}
+
+	g, err := app.newGist(r, owners, snippet, files, "", true)
+	if err != nil {
+		app.gistServerError(w, r, err)
+		return
+	}
+
+	g.History, err = app.newGistHistory(r, owners, revisions)
+	if err != nil {
+		app.gistServerError(w, r, err)
+		return
+	}
+
+	app.WriteJSON(w, r, status, g)
+}
+
+// writeGistList writes a listing of snippets as gists.
+func (app *Application) writeGistList(w http.ResponseWriter, r *http.Request, snippets []models.Snippet) {
+	owners := gistOwners{}
+	gists := []gist{}
+
+	for _, snippet := range snippets {
+		files, err := app.Snippets.Files(snippet)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		g, err := app.newGist(r, owners, snippet, files, "", false)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+		gists = append(gists, g)
+	}
+
+	app.WriteJSON(w, r, http.StatusOK, gists)
+}
+
+// gistPage reads GitHub's per_page and page (1-based) parameters.
+func gistPage(r *http.Request) (limit, offset int, err error) {
+	limit, err = queryInt(r, "per_page", gistDefaultPageSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit = min(max(limit, 1), gistMaxPageSize)
+
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return limit, (max(page, 1) - 1) * limit, nil
+}
+
+// decodeGist reads a gist request. Unknown fields are ignored since clients
+// send things like "public" on updates.
+func (app *Application) decodeGist(w http.ResponseWriter, r *http.Request) (*structs.GistStruct, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxGistBytes)
+
+	var input structs.GistStruct
+	err := json.NewDecoder(r.Body).Decode(&input)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.gistErrorResponse(w, r, http.StatusRequestEntityTooLarge, "Request body too large", nil)
+		} else {
+			app.gistErrorResponse(w, r, http.StatusBadRequest, "Problems parsing JSON", nil)
+		}
+		return nil, false
+	}
+
+	return &input, true
+}
+
+// validGist validates the final title and files of a gist and writes a
+// GitHub "Validation Failed" response when they aren't valid.
+func (app *Application) validGist(w http.ResponseWriter, r *http.Request, input *structs.GistStruct, title string, files []models.SnippetFile) bool {
+	input.ValidateFiles(title, files)
+	if input.Valid() {
+		return true
+	}
+
+	errs := []gistError{}
+	for field, message := range input.FieldErrors {
+		if message != "" {
+			code := "invalid"
+			if field == "Files" && len(files) == 0 {
+				code = "missing_field"
+			}
+			errs = append(errs, gistError{Resource: "Gist", Field: field, Code: code, Message: message})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+
+	app.gistErrorResponse(w, r, http.StatusUnprocessableEntity, "Validation Failed", errs)
+	return false
+}
+
+// gistTitle is the snippet title for a gist description. Gists may have no
+// description but snippets need a title, so fall back to the first file name,
+// cut down to the longest title allowed.
+func gistTitle(description string, files []models.SnippetFile) string {
+	if description == "" && len(files) > 0 {
+		title := []rune(files[0].Filename)
+		return string(title[:min(len(title), maxGistTitle)])
+	}
+	return description
+}
+
+// applyGistChanges applies the "files" of a gist update to the current files
+// of a snippet: null deletes a file, "filename" renames it and "content"
+// replaces it. Files are addressed by the names gists show for them, and
+// those that aren't mentioned stay as they are.
+//
+// JSON objects have no order, so deletes and renames are applied first and
+// content after, each in order of name, and a rename may not take a name
+// some file already has or another change refers to. The files keep their
+// order, with new ones added at the end, and only names that were sent are
+// stored. checked holds the same files with the names they are shown under,
+// for validation.
+func applyGistChanges(snippetID int, current []models.SnippetFile, changes map[string]*structs.GistFileInput) (files, checked []models.SnippetFile, err error) {
+	names := make([]string, 0, len(changes))
+	for name := range changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	shown := make([]string, len(current))
+	for i, f := range current {
+		shown[i] = f.DisplayName(snippetID, i)
+	}
+	files = slices.Clone(current)
+
+	find := func(name string) int {
+		return slices.Index(shown, name)
+	}
+
+	// Check every rename against the names as they were before any change,
+	// so the outcome can't depend on the order they are applied in.
+	targets := map[string]bool{}
+	for _, name := range names {
+		change := changes[name]
+		if change == nil || change.Filename == nil || *change.Filename == name {
+			continue
+		}
+		target := *change.Filename
+		_, named := changes[target]
+		if named || targets[target] || find(target) >= 0 {
+			return nil, nil, fmt.Errorf("%s: cannot be renamed to %s, which already exists or is changed too", name, target)
+		}
+		targets[target] = true
+	}
+
+	for _, name := range names {
+		change := changes[name]
+		i := find(name)
+
+		switch {
+		case change == nil:
+			if i >= 0 {
+				files = slices.Delete(files, i, i+1)
+				shown = slices.Delete(shown, i, i+1)
+			}
+		case change.Filename != nil && *change.Filename != name:
+			target := *change.Filename
+			if i < 0 {
+				files = append(files, models.SnippetFile{})
+				shown = append(shown, "")
+				i = len(files) - 1
+			}
+			files[i].Filename = target
+			files[i].Language = models.LanguageForFilename(target)
+			shown[i] = target
+		}
+	}
+
+	for _, name := range names {
+		change := changes[name]
+		if change == nil {
+			continue
+		}
+		if change.Filename != nil {
+			name = *change.Filename
+		}
+
+		i := find(name)
+		if i < 0 {
+			files = append(files, models.SnippetFile{Filename: name, Language: models.LanguageForFilename(name)})
+			shown = append(shown, name)
+			i = len(files) - 1
+		}
+		if change.Content != nil {
+			files[i].Content = *change.Content
+		}
+	}
+
+	checked = slices.Clone(files)
+	for i := range checked {
+		checked[i].Filename = shown[i]
+	}
+
+	return files, checked, nil
+}
+
+func (app *Application) ListGists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Like GitHub, anonymous requests get the public gists.
+		if app.APIToken(r) == nil {
+			app.ListPublicGists()(w, r)
+			return
+		}
+
+		if !app.gistRequireScope(w, r, models.ScopeSnippetsRead) {
+			return
+		}
+
+		limit, offset, err := gistPage(r)
+		if err != nil {
+			app.gistErrorResponse(w, r, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		snippets, err := app.Snippets.ForUser(app.CurrentUser(r).ID, limit, offset)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		app.writeGistList(w, r, snippets)
+	}
+}
+
+func (app *Application) ListPublicGists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, offset, err := gistPage(r)
+		if err != nil {
+			app.gistErrorResponse(w, r, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+
+		snippets, err := app.Snippets.List(limit, offset)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		app.writeGistList(w, r, snippets)
+	}
+}
+
+func (app *Application) GetGist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.gistSnippet(w, r, false)
+		if !ok {
+			return
+		}
+
+		app.writeGist(w, r, http.StatusOK, snippet)
+	}
+}
+
+func (app *Application) CreateGist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.gistRequireScope(w, r, models.ScopeSnippetsWrite) {
+			return
+		}
+
+		input, ok := app.decodeGist(w, r)
+		if !ok {
+			return
+		}
+
+		// GitHub sorts gist files by name, which also gives the files a
+		// stable order since JSON objects have none.
+		names := make([]string, 0, len(input.Files))
+		for name := range input.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		files := []models.SnippetFile{}
+		for _, name := range names {
+			f := models.SnippetFile{Filename: name, Language: models.LanguageForFilename(name)}
+			if input.Files[name] != nil && input.Files[name].Content != nil {
+				f.Content = *input.Files[name].Content
+			}
+			files = append(files, f)
+		}
+
+		var description string
+		if input.Description != nil {
+			description = *input.Description
+		}
+		title := gistTitle(description, files)
+
+		if !app.validGist(w, r, input, title, files) {
+			return
+		}
+
+		// Secret gists, the only kind GitHub has besides public ones, are
+		// unlisted snippets.
+		visibility := models.VisibilityPublic
+		if input.Public != nil && !*input.Public {
+			visibility = models.VisibilityUnlisted
+		}
+
+		id, err := app.Snippets.InsertFiles(app.CurrentUser(r).ID, title, files, visibility, gistExpires)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(id)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Location", absoluteURL(r, fmt.Sprintf("/gists/%d", id)))
+		app.writeGist(w, r, http.StatusCreated, snippet)
+	}
+}
+
+func (app *Application) UpdateGist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.gistRequireScope(w, r, models.ScopeSnippetsWrite) {
+			return
+		}
+
+		snippet, ok := app.gistSnippet(w, r, true)
+		if !ok {
+			return
+		}
+
+		input, ok := app.decodeGist(w, r)
+		if !ok {
+			return
+		}
+
+		current, err := app.Snippets.Files(snippet)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		files, checked, err := applyGistChanges(snippet.ID, current, input.Files)
+		if err != nil {
+			app.gistErrorResponse(w, r, http.StatusUnprocessableEntity, "Validation Failed",
+				[]gistError{{Resource: "Gist", Field: "Files", Code: "invalid", Message: err.Error()}})
+			return
+		}
+
+		title := snippet.Title
+		if input.Description != nil {
+			title = gistTitle(*input.Description, files)
+		}
+
+		if !app.validGist(w, r, input, title, checked) {
+			return
+		}
+
+		err = app.Snippets.UpdateFiles(snippet.ID, snippet.UserID, title, files, snippet.Visibility, gistExpires)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		snippet, err = app.Snippets.Get(snippet.ID)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		app.writeGist(w, r, http.StatusOK, snippet)
+	}
+}
+
+func (app *Application) DeleteGist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !app.gistRequireScope(w, r, models.ScopeSnippetsWrite) {
+			return
+		}
+
+		snippet, ok := app.gistSnippet(w, r, true)
+		if !ok {
+			return
+		}
+
+		err := app.deleteSnippet(r.Context(), snippet)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (app *Application) ListGistCommits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.gistSnippet(w, r, false)
+		if !ok {
+			return
+		}
+
+		revisions, err := app.Snippets.Revisions(snippet.ID)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		history, err := app.newGistHistory(r, gistOwners{}, revisions)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		app.WriteJSON(w, r, http.StatusOK, history)
+	}
+}
+
+func (app *Application) GetGistRevision() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.gistSnippet(w, r, false)
+		if !ok {
+			return
+		}
+
+		revision, err := app.Snippets.Revision(snippet.ID, r.PathValue("sha"))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.gistErrorResponse(w, r, http.StatusNotFound, "Not Found", nil)
+			} else {
+				app.gistServerError(w, r, err)
+			}
+			return
+		}
+
+		snippet.Title = revision.Title
+		snippet.Updated = revision.Committed
+
+		owners := gistOwners{}
+
+		g, err := app.newGist(r, owners, snippet, revision.Files, revision.Version, true)
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		g.History, err = app.newGistHistory(r, owners, []models.Revision{revision})
+		if err != nil {
+			app.gistServerError(w, r, err)
+			return
+		}
+
+		app.WriteJSON(w, r, http.StatusOK, g)
+	}
+}
+
+func (app *Application) GistNotFound() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.gistErrorResponse(w, r, http.StatusNotFound, "Not Found", nil)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"snippetbox/cmd/web/config"
 	"snippetbox/cmd/web/templates"
 	"snippetbox/internal/validator"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,7 +16,7 @@ type Application struct {
 	*config.ApplicationConfig
 }
 
-func NewApiConnection(dsn *string, addr *string) *Application {
+func NewApiConnection(dsn *string, addr *string, blobFlags *config.BlobFlags) *Application {
 
 	// Initializing the structured logger module.
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
@@ -22,7 +24,7 @@ func NewApiConnection(dsn *string, addr *string) *Application {
 	}))
 
 	// Initializing the application configuration module.
-	appConfig := config.NewApplicationConfigConnection(logger, dsn)
+	appConfig := config.NewApplicationConfigConnection(logger, dsn, blobFlags)
 	if appConfig == nil {
 		logger.Error("Error creating application config connection")
 		os.Exit(1)
@@ -45,8 +47,80 @@ func NewTemplateData[T any, M any](app *Application, r *http.Request, form *T, m
 	}
 
 	return &templates.TemplateData[T, M]{
-		CurrentYear: time.Now().Year(),
-		Flash:       app.SessionManager.PopString(r.Context(), "flash"),
-		Form:        form,
+		CurrentYear:     time.Now().Year(),
+		Flash:           app.SessionManager.PopString(r.Context(), "flash"),
+		IsAuthenticated: app.IsAuthenticated(r),
+		CurrentUser:     app.CurrentUser(r),
+		Form:            form,
+		Meta: templates.PageMeta{
+			Description: templates.DefaultDescription,
+			URL:         absoluteURL(r, requestPath(r)),
+		},
 	}
 }
+
+// requestPath is the path the client asked for. Areas are mounted with
+// http.StripPrefix, so r.URL.Path lacks their prefix.
+func requestPath(r *http.Request) string {
+	if r.RequestURI == "" {
+		return r.URL.Path
+	}
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+	return path
+}
+
+// negotiate picks the offered media type the client prefers according to its
+// Accept header. The first offer wins when there is no Accept header, and an
+// empty string means none of the offers are acceptable.
+func negotiate(r *http.Request, offers ...string) string {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return offers[0]
+	}
+
+	best, bestQ, bestSpecificity := "", 0.0, -1
+	for _, offer := range offers {
+		offerType, _, _ := strings.Cut(offer, "/")
+
+		// The quality of an offer comes from the most specific media range
+		// that matches it, so "text/plain;q=0, */*" rejects text/plain.
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(header, ",") {
+			mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			mediaType = strings.TrimSpace(mediaType)
+
+			var s int
+			switch mediaType {
+			case offer:
+				s = 2
+			case offerType + "/*":
+				s = 1
+			case "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+
+			specificity, q = s, 1.0
+			for _, param := range strings.Split(params, ";") {
+				if value, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+					if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+						q = parsed
+					}
+				}
+			}
+		}
+
+		// An offer the client names explicitly beats one it only accepts
+		// through a wildcard. Otherwise offers are listed in order of
+		// preference, so ties go to the earlier one.
+		if q > 0 && (q > bestQ || (q == bestQ && specificity > bestSpecificity)) {
+			best, bestQ, bestSpecificity = offer, q, specificity
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+	"strings"
+)
+
+// maxPasteBytes caps the size of a text paste sent to the command line
+// endpoint. Images may be up to maxImageBytes.
+const maxPasteBytes = 1 << 20
+
+// pasteExpiries maps the values accepted by the "expiry" query parameter to
+// a number of days. Unknown values fail validation like a bad form value.
+var pasteExpiries = map[string]int{
+	"":     7,
+	"1":    1,
+	"1d":   1,
+	"day":  1,
+	"7":    7,
+	"7d":   7,
+	"1w":   7,
+	"week": 7,
+	"365":  365,
+	"1y":   365,
+	"year": 365,
+}
+
+// readPaste returns the pasted text and, for multipart uploads of a file, its
+// file name. Multipart bodies use the first part whatever its field name, so
+// both `curl -F 'f=<-'` and `curl -F 'f=@file.go'` work. Anything else is
+// taken to be the raw content, which covers `curl --data-binary @file`.
+func readPaste(r *http.Request) (content, filename string, err error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		b, err := io.ReadAll(r.Body)
+		return string(b), "", err
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return "", "", err
+	}
+
+	part, err := mr.NextPart()
+	if err != nil {
+		if err == io.EOF {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	defer part.Close()
+
+	b, err := io.ReadAll(part)
+	return string(b), part.FileName(), err
+}
+
+// imageExtensions names pasted images that come without a file name.
+var imageExtensions = map[string]string{"image/png": ".png", "image/jpeg": ".jpg", "image/gif": ".gif"}
+
+// isImage reports whether pasted content is an image by its first bytes.
+func isImage(content string) bool {
+	return slices.Contains(imageTypes, http.DetectContentType([]byte(content[:min(len(content), 512)])))
+}
+
+// absoluteURL builds a full URL to a path on this site for responses that
+// leave the browser, such as the paste endpoint output.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host + path
+}
+
+func (app *Application) PostPaste() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+64<<10)
+
+		content, filename, err := readPaste(r)
+		if err == nil && !isImage(content) && len(content) > maxPasteBytes {
+			err = &http.MaxBytesError{Limit: maxPasteBytes}
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.ClientError(http.StatusRequestEntityTooLarge)(w, r)
+			} else {
+				app.ClientError(http.StatusBadRequest)(w, r)
+			}
+			return
+		}
+
+		// An image, like `curl -F f=@screenshot.png`, becomes a snippet made
+		// of that image alone.
+		var image *upload
+		if isImage(content) {
+			if filename == "" {
+				filename = "paste" + imageExtensions[http.DetectContentType([]byte(content[:min(len(content), 512)]))]
+			}
+			image, err = prepareUpload(filename, strings.NewReader(content))
+			if err != nil {
+				message := uploadErrorMessage(err)
+				if message == "" {
+					app.InternalServerError(err)(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintln(w, message)
+				return
+			}
+			content = ""
+		}
+
+		query := r.URL.Query()
+		title := query.Get("title")
+		if title == "" {
+			title = filename
+		}
+		if title == "" {
+			title = "Untitled paste"
+		}
+
+		form := &structs.SnippetStruct{
+			Title:    title,
+			Content:  content,
+			Language: query.Get("language"),
+			Expires:  pasteExpiries[query.Get("expiry")],
+
+			Visibility: query.Get("visibility"),
+		}
+		if image != nil {
+			form.Images = 1
+		}
+
+		form.Validate()
+		// Nobody could ever read an anonymous private paste.
+		form.CheckField(form.Visibility != models.VisibilityPrivate || app.IsAuthenticated(r), "Visibility",
+			"Anonymous pastes cannot be private")
+
+		if !form.Valid() {
+			fields := []string{}
+			for field, message := range form.FieldErrors {
+				if message != "" {
+					fields = append(fields, field+": "+message)
+				}
+			}
+			slices.Sort(fields)
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintln(w, strings.Join(fields, "\n"))
+			return
+		}
+
+		// Pastes are anonymous unless they come with an API token, which then
+		// has to allow writing snippets.
+		userID := 0
+		if app.IsAuthenticated(r) {
+			if !app.HasScope(r, models.ScopeSnippetsWrite) {
+				app.ClientError(http.StatusForbidden)(w, r)
+				return
+			}
+			userID = app.CurrentUser(r).ID
+		}
+
+		id, err := app.Snippets.Insert(userID, form.Title, form.Content, form.Language,
+			form.VisibilityOr(models.VisibilityPublic), form.Expires)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		if image != nil {
+			if err = app.storeUpload(r.Context(), id, userID, image); err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+		}
+
+		url := absoluteURL(r, fmt.Sprintf("/snippet/view/%d", id))
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Location", url)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintln(w, url)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+)
+
+// starsPerPage is how many snippets the starred list shows at a time.
+const starsPerPage = 50
+
+// starsPage is the data behind the list of snippets a user starred.
+type starsPage struct {
+	Snippets []snippetListItem
+	// Page counts from 1. Next is 0 on the last page.
+	Page int
+	Prev int
+	Next int
+}
+
+// PostStarSnippet stars or unstars a snippet for the current user, depending
+// on the action posted rather than on whether it is starred already, so that
+// a form sent twice leaves the star as it was asked to be.
+func (app *Application) PostStarSnippet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.snippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		userID := app.CurrentUser(r).ID
+
+		var err error
+		switch r.PostForm.Get("action") {
+		case "star":
+			err = app.Stars.Star(userID, snippet.ID)
+		case "unstar":
+			err = app.Stars.Unstar(userID, snippet.ID)
+		default:
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		http.Redirect(w, r, fmt.Sprintf("/snippet/view/%d", snippet.ID), http.StatusSeeOther)
+	}
+}
+
+// GetUserStars lists the snippets the current user starred, most recently
+// starred first.
+func (app *Application) GetUserStars() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := queryInt(r, "page", 1)
+		if err != nil || page < 1 {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		// One more than fits tells whether there is a next page.
+		snippets, err := app.Snippets.StarredBy(app.CurrentUser(r).ID, starsPerPage+1, (page-1)*starsPerPage)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		data := NewTemplateData[structs.UserStruct, starsPage](app, r, nil, structs.UserStruct{})
+		data.Data.Page = page
+		data.Data.Prev = page - 1
+		if len(snippets) > starsPerPage {
+			snippets = snippets[:starsPerPage]
+			data.Data.Next = page + 1
+		}
+
+		data.Data.Snippets, err = app.newSnippetListItems(snippets)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.Render(w, r, http.StatusOK, "stars.tmpl.html", data)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+)
+
+// statsDays is how many days the stats page shows.
+const statsDays = 30
+
+// Size of the views chart and the room left for its labels, in SVG units.
+const (
+	chartWidth  = 720
+	chartHeight = 240
+	chartLeft   = 40
+	chartBottom = 24
+)
+
+// statsPage is the data behind the stats page of a snippet.
+type statsPage struct {
+	Snippet models.Snippet
+	Days    []models.DayStats
+	// Views is the total over the days shown.
+	Views int
+	Chart viewsChart
+}
+
+// viewsChart is a bar chart of views per day, drawn as SVG by the template.
+// Each bar has the unique visitors of the day drawn over it.
+type viewsChart struct {
+	Width, Height int
+	// Base is the y of the x axis and Left the x of the y axis.
+	Base, Left float64
+	Bars       []chartBar
+	Ticks      []chartTick
+}
+
+type chartBar struct {
+	X, Width             float64
+	Y, Height            float64
+	VisitorsY, VisitorsH float64
+	Label                string
+	Title                string
+	LabelX               float64
+	ShowLabel            bool
+}
+
+// chartTick is a value marked on the y axis.
+type chartTick struct {
+	Y     float64
+	Value int
+}
+
+// niceMax rounds the largest value up to 1, 2 or 5 times a power of ten, so
+// the axis ticks land on round numbers.
+func niceMax(n int) int {
+	step := 1
+	for {
+		for _, m := range []int{1, 2, 5} {
+			if n <= m*step {
+				return m * step
+			}
+		}
+		step *= 10
+	}
+}
+
+// round keeps chart coordinates to a tenth of a unit, plenty on screen.
+func round(f float64) float64 {
+	return math.Round(f*10) / 10
+}
+
+func newViewsChart(days []models.DayStats) viewsChart {
+	c := viewsChart{Width: chartWidth, Height: chartHeight, Left: chartLeft, Base: chartHeight - chartBottom}
+	if len(days) == 0 {
+		return c
+	}
+
+	top := 0
+	for _, d := range days {
+		top = max(top, d.Views)
+	}
+	top = niceMax(max(top, 1))
+
+	plotHeight := c.Base - 8
+	scale := func(n int) float64 { return round(float64(n) / float64(top) * plotHeight) }
+
+	ticks := []int{0, top}
+	if top%2 == 0 {
+		ticks = []int{0, top / 2, top}
+	}
+	for _, v := range ticks {
+		c.Ticks = append(c.Ticks, chartTick{Y: c.Base - scale(v), Value: v})
+	}
+
+	slot := (chartWidth - chartLeft) / float64(len(days))
+	for i, d := range days {
+		// Estimates can come out a little over the exact view count.
+		visitors := min(int(d.Visitors), d.Views)
+		b := chartBar{
+			X:         round(chartLeft + float64(i)*slot + slot*0.15),
+			Width:     round(slot * 0.7),
+			Height:    scale(d.Views),
+			VisitorsH: scale(visitors),
+			Label:     d.Day.Format("Jan 2"),
+			LabelX:    round(chartLeft + float64(i)*slot + slot/2),
+			// A label every week is as many as fit.
+			ShowLabel: (len(days)-1-i)%7 == 0,
+			Title:     fmt.Sprintf("%s: %d views, about %d visitors", d.Day.Format("Mon Jan 2"), d.Views, visitors),
+		}
+		b.Y = c.Base - b.Height
+		b.VisitorsY = c.Base - b.VisitorsH
+		c.Bars = append(c.Bars, b)
+	}
+
+	return c
+}
+
+// GetSnippetStats shows the owner of a snippet how often it was viewed over
+// the last days and by about how many people each day.
+func (app *Application) GetSnippetStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snippet, ok := app.ownedSnippetFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		days, err := app.Snippets.ViewStats(snippet.ID, statsDays)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		page := statsPage{Snippet: snippet, Days: days, Chart: newViewsChart(days)}
+		for _, d := range days {
+			page.Views += d.Views
+		}
+
+		data := NewTemplateData[structs.SnippetStruct, statsPage](app, r, nil, structs.SnippetStruct{})
+		data.Data = page
+		data.Meta.NoIndex = true
+
+		app.Render(w, r, http.StatusOK, "stats.tmpl.html", data)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+	"strconv"
+)
+
+// apiTokensPage is the data behind the personal API tokens settings page.
+type apiTokensPage struct {
+	Tokens   []models.APIToken
+	Scopes   []string
+	NewToken string
+}
+
+func (app *Application) renderAPITokens(w http.ResponseWriter, r *http.Request, status int, form *structs.APITokenStruct) {
+	tokens, err := app.APITokens.ForUser(app.CurrentUser(r).ID)
+	if err != nil {
+		app.InternalServerError(err)(w, r)
+		return
+	}
+
+	data := NewTemplateData[structs.APITokenStruct, apiTokensPage](app, r, form, structs.APITokenStruct{})
+	data.Data = apiTokensPage{
+		Tokens: tokens,
+		Scopes: models.Scopes,
+		// The plaintext of a new token is only ever shown on the page the user
+		// is redirected to right after creating it.
+		NewToken: app.SessionManager.PopString(r.Context(), constants.SessionNewAPIToken),
+	}
+
+	app.Render(w, r, status, "tokens.tmpl.html", data)
+}
+
+func (app *Application) GetAPITokens() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app.renderAPITokens(w, r, http.StatusOK, nil)
+	}
+}
+
+func (app *Application) PostCreateAPIToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var form *structs.APITokenStruct
+
+		err := app.DecodePostForm(r, &form)
+		if err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		form.Validate()
+
+		if !form.Valid() {
+			app.renderAPITokens(w, r, http.StatusUnprocessableEntity, form)
+			return
+		}
+
+		token, err := app.APITokens.Insert(app.CurrentUser(r).ID, form.Name, form.Scopes)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), constants.SessionNewAPIToken, token)
+		app.SessionManager.Put(r.Context(), "flash", "Token created. Copy it now, you won't be able to see it again.")
+
+		http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+	}
+}
+
+func (app *Application) RevokeAPIToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(err)(w, r)
+			return
+		}
+
+		err = app.APITokens.Delete(id, app.CurrentUser(r).ID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "The token has been revoked.")
+		http.Redirect(w, r, "/user/tokens", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"snippetbox/cmd/web/structs"
+	"snippetbox/internal/models"
+)
+
+// trendingLimit is how many snippets the trending page ranks.
+const trendingLimit = 25
+
+// trendingPage is the data behind the trending page.
+type trendingPage struct {
+	Window   models.TrendingWindow
+	Windows  []models.TrendingWindow
+	Snippets []snippetListItem
+}
+
+// GetSnippetTrending ranks public snippets by how much they were viewed and
+// starred in the window named by ?window=, today by default. The scores are
+// computed in the background, see RunTrendingWorker.
+func (app *Application) GetSnippetTrending() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window := models.TrendingWindows[0]
+		if name := r.URL.Query().Get("window"); name != "" {
+			found := false
+			for _, tw := range models.TrendingWindows {
+				if tw.Name == name {
+					window, found = tw, true
+				}
+			}
+			if !found {
+				app.NotFound(fmt.Errorf("unknown trending window %q", name))(w, r)
+				return
+			}
+		}
+
+		snippets, err := app.Snippets.Trending(window.Name, trendingLimit)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		items, err := app.newSnippetListItems(snippets)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		data := NewTemplateData[structs.SnippetStruct, trendingPage](app, r, nil, structs.SnippetStruct{})
+		data.Data = trendingPage{Window: window, Windows: models.TrendingWindows, Snippets: items}
+
+		app.Render(w, r, http.StatusOK, "trending.tmpl.html", data)
+	}
+}
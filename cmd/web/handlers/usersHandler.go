@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	stdErrors "errors"
 	"net/http"
+	"net/url"
+	"snippetbox/cmd/web/config"
+	"snippetbox/cmd/web/constants"
 	"snippetbox/cmd/web/structs"
 	"snippetbox/internal/errors"
 	"snippetbox/internal/models"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
 func (app *Application) UserSignup() http.HandlerFunc {
@@ -90,23 +97,66 @@ func (app *Application) UserLoginPost() http.HandlerFunc {
 			return
 		}
 
-		app.SessionManager.Put(r.Context(), "authenticatedUserID", id)
+		// Give the session a new token whenever its privilege level changes so a
+		// token planted before login (session fixation) becomes useless.
+		err = app.SessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), constants.SessionAuthenticatedUserID, id)
+
+		err = app.UserSessions.Insert(app.SessionManager.Token(r.Context()), id, r.UserAgent(), config.ClientIP(r))
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
 		app.SessionManager.Put(r.Context(), "flash", "You are now logged in.")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+
+		// Send the user back to the page that asked them to log in, as long as
+		// it is a path on this site.
+		path := app.SessionManager.PopString(r.Context(), constants.SessionRedirectAfterLogin)
+		if !localPath(path) {
+			path = "/"
+		}
+		http.Redirect(w, r, path, http.StatusSeeOther)
 	}
 }
 
+// localPath reports whether path is a path on this site. Browsers read a
+// backslash as a slash, so "/\evil.example" would lead to another host just
+// like "//evil.example" does; those and control characters are refused.
+func localPath(path string) bool {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.ContainsFunc(path, func(r rune) bool {
+		return r == '\\' || unicode.IsControl(r)
+	}) {
+		return false
+	}
+
+	u, err := url.Parse(path)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
 func (app *Application) UserLogout() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Forget the session in the "your sessions" list.
+		err := app.UserSessions.Delete(app.SessionManager.Token(r.Context()))
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
 		// Get the flash message from the session.
-		err := app.SessionManager.RenewToken(r.Context())
+		err = app.SessionManager.RenewToken(r.Context())
 		if err != nil {
 			app.InternalServerError(err)(w, r)
 			return
 		}
 
 		// Remove the authenticatedUserID and flash values from the session.
-		app.SessionManager.Remove(r.Context(), "authenticatedUserID")
+		app.SessionManager.Remove(r.Context(), constants.SessionAuthenticatedUserID)
 		app.SessionManager.Put(r.Context(), "flash", "You've been logged out successfully.")
 
 		// Redirect the user to the home page.
@@ -114,10 +164,16 @@ func (app *Application) UserLogout() http.HandlerFunc {
 	}
 }
 
+// renderProfile shows the account page, whose form changes the password.
+func (app *Application) renderProfile(w http.ResponseWriter, r *http.Request, status int, form *structs.PasswordStruct) {
+	data := NewTemplateData[structs.PasswordStruct, models.User](app, r, form, structs.PasswordStruct{})
+	data.Data = *app.CurrentUser(r)
+	app.Render(w, r, status, "profile.tmpl.html", data)
+}
+
 func (app *Application) UserProfile() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data := NewTemplateData[structs.UserStruct, models.User](app, r, nil, structs.UserStruct{})
-		app.Render(w, r, http.StatusOK, "profile.tmpl.html", data)
+		app.renderProfile(w, r, http.StatusOK, nil)
 	}
 }
 
@@ -128,9 +184,125 @@ func (app *Application) UpdateUserProfile() http.HandlerFunc {
 	}
 }
 
+// ResetUserPassword changes the password of the current user. Whoever knew
+// the old password may still be signed in somewhere, so every other session
+// is signed out and this one moves to a new token.
 func (app *Application) ResetUserPassword() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		data := NewTemplateData[structs.UserStruct, models.User](app, r, nil, structs.UserStruct{})
-		app.Render(w, r, http.StatusOK, "update_profile.tmpl.html", data)
+		var form structs.PasswordStruct
+		if err := app.DecodePostForm(r, &form); err != nil {
+			app.ClientError(http.StatusBadRequest)(w, r)
+			return
+		}
+
+		user := app.CurrentUser(r)
+
+		form.Validate()
+		if form.Valid() {
+			_, err := app.Users.Authenticate(user.Email, form.CurrentPassword)
+			if err == errors.ErrInvalidCredentials {
+				form.AddFieldError("CurrentPassword", "This password is incorrect")
+			} else if err != nil {
+				app.InternalServerError(err)(w, r)
+				return
+			}
+		}
+		if !form.Valid() {
+			app.renderProfile(w, r, http.StatusUnprocessableEntity, &form)
+			return
+		}
+
+		err := app.Users.UpdatePassword(user.ID, form.NewPassword)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		// Revoking every session includes this one, whose data RenewToken then
+		// saves again under a new token.
+		err = app.UserSessions.RevokeAll(user.ID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		err = app.SessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		err = app.UserSessions.Insert(app.SessionManager.Token(r.Context()), user.ID, r.UserAgent(), config.ClientIP(r))
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "Your password has been changed and your other sessions signed out.")
+		http.Redirect(w, r, "/user/profile", http.StatusSeeOther)
+	}
+}
+
+func (app *Application) UserSessionList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessions, err := app.UserSessions.Active(app.CurrentUser(r).ID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		token := app.SessionManager.Token(r.Context())
+		for i := range sessions {
+			sessions[i].Current = sessions[i].Token == token
+		}
+
+		data := NewTemplateData[structs.UserStruct, []models.UserSession](app, r, nil, structs.UserStruct{})
+		data.Data = sessions
+		app.Render(w, r, http.StatusOK, "sessions.tmpl.html", data)
+	}
+}
+
+func (app *Application) RevokeUserSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(err)(w, r)
+			return
+		}
+
+		err = app.UserSessions.Revoke(id, app.CurrentUser(r).ID)
+		if err != nil {
+			if stdErrors.Is(err, models.ErrNoRecord) {
+				app.NotFound(err)(w, r)
+			} else {
+				app.InternalServerError(err)(w, r)
+			}
+			return
+		}
+
+		app.SessionManager.Put(r.Context(), "flash", "The session has been signed out.")
+		http.Redirect(w, r, "/user/sessions", http.StatusSeeOther)
+	}
+}
+
+func (app *Application) RevokeAllUserSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := app.UserSessions.RevokeAll(app.CurrentUser(r).ID)
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		// The current session was revoked along with the rest, so move this
+		// request onto a fresh anonymous session to carry the flash message.
+		err = app.SessionManager.RenewToken(r.Context())
+		if err != nil {
+			app.InternalServerError(err)(w, r)
+			return
+		}
+
+		app.SessionManager.Remove(r.Context(), constants.SessionAuthenticatedUserID)
+		app.SessionManager.Put(r.Context(), "flash", "You've been signed out everywhere.")
+		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 	}
 }
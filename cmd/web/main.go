@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
 	"log/slog"
 	"net/http"
+	"os"
+	"snippetbox/cmd/web/config"
 	"snippetbox/cmd/web/constants"
 	"snippetbox/cmd/web/handlers"
 	"snippetbox/cmd/web/routes"
@@ -16,12 +19,13 @@ func main() {
 	// Getting the address from the command line flag.
 	addr := flag.String("addr", constants.PORT, "HTTP network address")
 	dsn := flag.String("dsn", constants.DATABASE_CONNECTION_STRING, "PostgreSQL data source name")
+	blobFlags := config.NewBlobFlags()
 
 	// Parsing the command line flags.
 	flag.Parse()
 
 	// Initialize the app config, logger and database.
-	app := handlers.NewApiConnection(dsn, addr)
+	app := handlers.NewApiConnection(dsn, addr, blobFlags)
 
 	// Derer the closing of the database if application closes.
 	defer func() {
@@ -30,8 +34,22 @@ func main() {
 		}
 	}()
 
+	// Delete expired snippets in the background.
+	go app.RunExpiryWorker(context.Background(), 10*time.Minute)
+
+	// Rank snippets for the trending page in the background.
+	go app.RunTrendingWorker(context.Background(), 5*time.Minute)
+
+	// Save the counted snippet views in batches.
+	go app.Views.Run(context.Background(), 30*time.Second)
+
 	// initialize the routes for our api's.
-	router := routes.InitRoutes(app)
+	router, err := routes.InitRoutes(app)
+	if err != nil {
+		// Refuse to start with a spec that no longer describes the API.
+		app.Logger.Error("The OpenAPI specification is out of date", "error", err)
+		os.Exit(1)
+	}
 
 	// TLS configuration.
 	tlsConfig := &tls.Config{
@@ -55,6 +73,11 @@ func main() {
 		app.Logger.Error("Failed to start the server", "error", listenErr)
 	}
 
+	// Keep the views that were counted since the last flush.
+	if err := app.Views.Flush(context.Background()); err != nil {
+		app.Logger.Error("Failed to save snippet views", "error", err)
+	}
+
 	// Log the server start.
 	app.Logger.Info("Server started", "address", *addr)
 }
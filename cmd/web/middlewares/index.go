@@ -1,14 +1,31 @@
 package middlewares
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 type Middlewares struct {
 	CommonHeaders func(next http.Handler) http.Handler
+	// CreateRateLimit is shared by every route that creates content so a
+	// client can't get around it by switching between the form, the API
+	// and the paste endpoint.
+	CreateRateLimit func(next http.Handler) http.Handler
+	// RenderRateLimit guards the pages that are expensive to produce, such
+	// as code images and archives, which anyone can request as often as
+	// they like.
+	RenderRateLimit func(next http.Handler) http.Handler
+	// AllowFraming lifts the framing ban of CommonHeaders for the pages
+	// meant to be embedded on other sites.
+	AllowFraming func(next http.Handler) http.Handler
 }
 
 func NewMiddlewares() *Middlewares {
 	return &Middlewares{
-		CommonHeaders: CommonHeaders,
+		CommonHeaders:   CommonHeaders,
+		CreateRateLimit: NewRateLimiter(6*time.Second, 10).Limit,
+		RenderRateLimit: NewRateLimiter(time.Second, 30).Limit,
+		AllowFraming:    AllowFraming,
 	}
 }
 
@@ -25,3 +42,14 @@ func CommonHeaders(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// AllowFraming must run inside CommonHeaders, whose headers it replaces.
+func AllowFraming(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Del("X-Frame-Options")
+		w.Header().Set("Content-Security-Policy",
+			"default-src 'self'; style-src 'self' fonts.googleapis.com; font-src fonts.gstatic.com; frame-ancestors *")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,89 @@
+package middlewares
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a per client IP token bucket. Each client may make up to
+// burst requests at once and then one more request every interval.
+type RateLimiter struct {
+	mu       sync.Mutex
+	clients  map[string]*bucket
+	interval time.Duration
+	burst    float64
+}
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func NewRateLimiter(interval time.Duration, burst int) *RateLimiter {
+	rl := &RateLimiter{
+		clients:  make(map[string]*bucket),
+		interval: interval,
+		burst:    float64(burst),
+	}
+
+	// Forget clients that have been idle long enough to have a full bucket.
+	go func() {
+		for range time.Tick(time.Minute) {
+			rl.mu.Lock()
+			for ip, b := range rl.clients {
+				if time.Since(b.lastSeen) > rl.interval*time.Duration(burst) {
+					delete(rl.clients, ip)
+				}
+			}
+			rl.mu.Unlock()
+		}
+	}()
+
+	return rl
+}
+
+// allow takes a token from the client's bucket. When the bucket is empty it
+// returns how long the client has to wait for the next token.
+func (rl *RateLimiter) allow(ip string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	b, ok := rl.clients[ip]
+	if !ok {
+		b = &bucket{tokens: rl.burst}
+		rl.clients[ip] = b
+	} else {
+		b.tokens = math.Min(rl.burst, b.tokens+float64(now.Sub(b.lastSeen))/float64(rl.interval))
+	}
+	b.lastSeen = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) * float64(rl.interval))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		ok, wait := rl.allow(ip)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"net/http"
+	"snippetbox/cmd/web/handlers"
+	"snippetbox/internal/models"
+)
+
+// APIPrefix is where the versioned JSON API is mounted.
+const APIPrefix = "/api/v1"
+
+// NewAPIRouter serves the versioned JSON API. It is authenticated with
+// personal API tokens only, so it doesn't load the session cookie. It fails
+// when the OpenAPI spec no longer describes the routes.
+func NewAPIRouter(app *handlers.Application) (http.Handler, error) {
+	r := NewRouter()
+	InitAPIRoutes(r, app)
+
+	if err := app.APISpec.CheckRoutes(APIPrefix, r.Patterns()); err != nil {
+		return nil, err
+	}
+
+	return app.AuthenticateToken(r.Handler()), nil
+}
+
+func InitAPIRoutes(r *Router, app *handlers.Application) {
+	requireRead := app.RequireTokenScope(models.ScopeSnippetsRead)
+	requireWrite := app.RequireTokenScope(models.ScopeSnippetsWrite)
+	requireProfile := app.RequireTokenScope(models.ScopeProfile)
+
+	r.Handle("GET /snippets", requireRead(app.APIListSnippets()))
+	r.Handle("POST /snippets", requireWrite(app.Middlewares.CreateRateLimit(app.APICreateSnippet())))
+	r.Handle("GET /snippets/{id}", requireRead(app.APIGetSnippet()))
+	r.Handle("PUT /snippets/{id}", requireWrite(app.APIUpdateSnippet()))
+	r.Handle("DELETE /snippets/{id}", requireWrite(app.APIDeleteSnippet()))
+	r.Handle("GET /me", requireProfile(app.APICurrentUser()))
+	r.HandleFunc("/", app.APINotFound())
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"path/filepath"
+	"snippetbox/cmd/web/config"
+	"snippetbox/cmd/web/handlers"
+	"snippetbox/cmd/web/middlewares"
+	"snippetbox/internal/openapi"
+	"testing"
+)
+
+// TestAPIRoutesMatchSpec fails when a JSON API route is added, removed or
+// renamed without the OpenAPI spec following, or the other way round.
+func TestAPIRoutesMatchSpec(t *testing.T) {
+	spec, err := openapi.Load(filepath.Join("..", "..", "..", "ui", "api", "openapi.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := &handlers.Application{ApplicationConfig: &config.ApplicationConfig{
+		Middlewares: middlewares.NewMiddlewares(),
+	}}
+
+	r := NewRouter()
+	InitAPIRoutes(r, app)
+
+	if err := spec.CheckRoutes(APIPrefix, r.Patterns()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"net/http"
+	"snippetbox/cmd/web/handlers"
+)
+
+// NewGistRouter serves the GitHub Gist compatible API. Like the JSON API it
+// only accepts API tokens; the scope checks happen in the handlers so that
+// errors come back in GitHub's format.
+func NewGistRouter(app *handlers.Application) http.Handler {
+	r := NewRouter()
+	InitGistRoutes(r, app)
+	return app.AuthenticateToken(r.Handler())
+}
+
+func InitGistRoutes(r *Router, app *handlers.Application) {
+	r.HandleFunc("GET /gists", app.ListGists())
+	r.Handle("POST /gists", app.Middlewares.CreateRateLimit(app.CreateGist()))
+	r.HandleFunc("GET /gists/public", app.ListPublicGists())
+	r.HandleFunc("GET /gists/{id}", app.GetGist())
+	r.HandleFunc("PATCH /gists/{id}", app.UpdateGist())
+	r.HandleFunc("DELETE /gists/{id}", app.DeleteGist())
+	r.HandleFunc("GET /gists/{id}/commits", app.ListGistCommits())
+	r.HandleFunc("GET /gists/{id}/{sha}", app.GetGistRevision())
+	r.HandleFunc("/gists/", app.GistNotFound())
+}
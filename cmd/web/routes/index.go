@@ -6,22 +6,38 @@ import (
 )
 
 type Router struct {
-	Mux *http.ServeMux
+	Mux      *http.ServeMux
+	patterns []string
 }
 
-func InitRoutes(app *handlers.Application) http.Handler {
+func InitRoutes(app *handlers.Application) (http.Handler, error) {
+	api, err := NewAPIRouter(app)
+	if err != nil {
+		return nil, err
+	}
+
 	masterMux := http.NewServeMux()
 	masterMux.Handle("/static/", http.StripPrefix("/static", NewStaticRouter(app)))
 	masterMux.Handle("/user/", http.StripPrefix("/user", NewUserRouter(app)))
 	masterMux.Handle("/snippet/", http.StripPrefix("/snippet", NewSnippetRouter(app)))
+	masterMux.Handle(APIPrefix+"/", http.StripPrefix(APIPrefix, api))
+	masterMux.Handle("GET /api/openapi.json", app.GetOpenAPISpec())
+	masterMux.Handle("GET /oembed", app.GetOEmbed())
+	gists := NewGistRouter(app)
+	masterMux.Handle("/gists", gists)
+	masterMux.Handle("/gists/", gists)
+	masterMux.Handle("GET /api/docs",
+		app.SessionManager.LoadAndSave(app.Authenticate(app.GetAPIDocs())))
+	masterMux.Handle("POST /{$}",
+		app.Middlewares.CreateRateLimit(app.AuthenticateToken(app.PostPaste())))
 	masterMux.Handle("/",
-		app.SessionManager.LoadAndSave(app.GetSnippetHome()))
+		app.SessionManager.LoadAndSave(app.Authenticate(app.AuthenticateToken(app.GetSnippetHome()))))
 
 	return app.RecoverPanic(
 		app.LogRequest(
 			app.Middlewares.CommonHeaders(masterMux),
 		),
-	)
+	), nil
 }
 
 func NewRouter() *Router {
@@ -29,13 +45,20 @@ func NewRouter() *Router {
 }
 
 func (r *Router) Handle(pattern string, handler http.Handler) {
+	r.patterns = append(r.patterns, pattern)
 	r.Mux.Handle(pattern, handler)
 }
 
 func (r *Router) HandleFunc(pattern string, handler http.HandlerFunc) {
+	r.patterns = append(r.patterns, pattern)
 	r.Mux.HandleFunc(pattern, handler)
 }
 
+// Patterns returns the patterns registered on the router in order.
+func (r *Router) Patterns() []string {
+	return r.patterns
+}
+
 func (r *Router) Handler() http.Handler {
 	return r.Mux
 }
@@ -3,19 +3,49 @@ package routes
 import (
 	"net/http"
 	"snippetbox/cmd/web/handlers"
+	"snippetbox/internal/models"
 )
 
 func NewSnippetRouter(app *handlers.Application) http.Handler {
 	r := NewRouter()
 	InitSnippetRoutes(r, app)
-	return app.SessionManager.LoadAndSave(r.Handler())
+	return app.SessionManager.LoadAndSave(app.Authenticate(app.AuthenticateToken(r.Handler())))
 }
 
 func InitSnippetRoutes(r *Router, app *handlers.Application) {
 	r.HandleFunc("GET /latest", app.GetSnippetHome())
-	r.HandleFunc("GET /create", app.GetCreateSnippet())
-	r.HandleFunc("POST /create", app.PostCreateSnippet())
-	r.HandleFunc("PUT /update", app.UpdateSnippetById())
+	r.HandleFunc("GET /trending", app.GetSnippetTrending())
 	r.HandleFunc("GET /view/{id}", app.GetSnippetById())
+	r.HandleFunc("GET /raw/{id}", app.GetRawSnippet())
+	r.Handle("GET /image/{id}", app.Middlewares.RenderRateLimit(app.GetSnippetImage()))
+	r.Handle("GET /card/{id}", app.Middlewares.RenderRateLimit(app.GetSnippetCard()))
+	r.Handle("GET /embed/{id}", app.Middlewares.AllowFraming(app.GetSnippetEmbed()))
+	r.HandleFunc("GET /download/{id}", app.DownloadSnippetArchive())
+	r.HandleFunc("GET /compare/{id}", app.GetSnippetCompare())
+	r.HandleFunc("GET /collection/{id}", app.GetCollection())
+	r.Handle("GET /collection/{id}/download", app.Middlewares.RenderRateLimit(app.DownloadCollectionArchive()))
 	r.HandleFunc("GET /list", app.GetAllSnippets())
+	r.HandleFunc("GET /attachment/{id}/{attachment}", app.GetAttachment())
+	r.HandleFunc("GET /attachment/{id}/{attachment}/thumb", app.GetAttachmentThumbnail())
+
+	// Routes that require a logged in user.
+	requireWrite := app.RequireScope(models.ScopeSnippetsWrite)
+	r.Handle("GET /stats/{id}", app.RequireScope(models.ScopeSnippetsRead)(app.GetSnippetStats()))
+	r.Handle("GET /create", requireWrite(app.GetCreateSnippet()))
+	r.Handle("POST /create", requireWrite(app.Middlewares.CreateRateLimit(app.PostCreateSnippet())))
+	r.Handle("PUT /update", requireWrite(app.UpdateSnippetById()))
+	r.Handle("POST /fork/{id}", requireWrite(app.Middlewares.CreateRateLimit(app.PostForkSnippet())))
+	r.Handle("POST /star/{id}", requireWrite(app.PostStarSnippet()))
+	r.Handle("POST /collect/{id}", requireWrite(app.PostCollectSnippet()))
+	r.Handle("POST /collection/{id}/edit", requireWrite(app.PostEditCollection()))
+	r.Handle("POST /collection/{id}/delete", requireWrite(app.DeleteCollection()))
+	r.Handle("POST /collection/{id}/snippet", requireWrite(app.PostCollectionSnippet()))
+	r.Handle("POST /attach/{id}", requireWrite(app.Middlewares.CreateRateLimit(app.PostAttachment())))
+	r.Handle("POST /attachment/{id}/{attachment}/delete", requireWrite(app.DeleteAttachment()))
+	r.Handle("POST /comment/{id}", requireWrite(app.Middlewares.CreateRateLimit(app.PostLineComment())))
+	r.Handle("POST /discussion/{id}", requireWrite(app.Middlewares.CreateRateLimit(app.PostComment())))
+	r.Handle("GET /discussion/{id}/{comment}/edit", requireWrite(app.GetEditComment()))
+	r.Handle("POST /discussion/{id}/{comment}/edit", requireWrite(app.PostEditComment()))
+	r.Handle("POST /discussion/{id}/{comment}/delete", requireWrite(app.DeleteComment()))
+	r.Handle("POST /discussion/{id}/{comment}/moderate", requireWrite(app.ModerateComment()))
 }
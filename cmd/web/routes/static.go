@@ -45,7 +45,7 @@ func NewStaticRouter(app *handlers.Application) http.Handler {
 func InitStaticRoutes(r *Router, app *handlers.Application) {
 	cwd, err := os.Getwd()
 	if err != nil {
-		app.Logger.Error("Failed to get current working directory", err)
+		app.Logger.Error("Failed to get current working directory", "error", err)
 		return
 	}
 
@@ -3,21 +3,36 @@ package routes
 import (
 	"net/http"
 	"snippetbox/cmd/web/handlers"
+	"snippetbox/internal/models"
 )
 
 func NewUserRouter(app *handlers.Application) http.Handler {
 	r := NewRouter()
 	InitUserRoutes(r, app)
-	return app.SessionManager.LoadAndSave(r.Handler())
+	return app.SessionManager.LoadAndSave(app.Authenticate(app.AuthenticateToken(r.Handler())))
 }
 
 func InitUserRoutes(r *Router, app *handlers.Application) {
-	r.HandleFunc("GET /signup", app.UserSignup())
-	r.HandleFunc("POST /signup", app.UserSignupPost())
-	r.HandleFunc("GET /login", app.UserLogin())
-	r.HandleFunc("POST /login", app.UserLoginPost())
-	r.HandleFunc("POST /logout", app.UserLogout())
-	r.HandleFunc("GET /profile", app.UserProfile())
-	r.HandleFunc("PUT /profile/update", app.UpdateUserProfile())
-	r.HandleFunc("POST /reset-password", app.ResetUserPassword())
+	// Routes only visitors who are not logged in may use.
+	r.Handle("GET /signup", app.RequireAnonymous(app.UserSignup()))
+	r.Handle("POST /signup", app.RequireAnonymous(app.UserSignupPost()))
+	r.Handle("GET /login", app.RequireAnonymous(app.UserLogin()))
+	r.Handle("POST /login", app.RequireAnonymous(app.UserLoginPost()))
+
+	// Routes that require a logged in user.
+	r.Handle("GET /profile", app.RequireScope(models.ScopeProfile)(app.UserProfile()))
+	r.Handle("PUT /profile/update", app.RequireScope(models.ScopeProfile)(app.UpdateUserProfile()))
+
+	// Account security routes, which API tokens must never reach.
+	r.Handle("POST /logout", app.RequireSessionLogin(app.UserLogout()))
+	r.Handle("POST /reset-password", app.RequireSessionLogin(app.ResetUserPassword()))
+	r.Handle("GET /sessions", app.RequireSessionLogin(app.UserSessionList()))
+	r.Handle("GET /stars", app.RequireSessionLogin(app.GetUserStars()))
+	r.Handle("GET /collections", app.RequireSessionLogin(app.GetUserCollections()))
+	r.Handle("POST /collections", app.RequireSessionLogin(app.PostCreateCollection()))
+	r.Handle("POST /sessions/{id}/revoke", app.RequireSessionLogin(app.RevokeUserSession()))
+	r.Handle("POST /sessions/revoke-all", app.RequireSessionLogin(app.RevokeAllUserSessions()))
+	r.Handle("GET /tokens", app.RequireSessionLogin(app.GetAPITokens()))
+	r.Handle("POST /tokens", app.RequireSessionLogin(app.PostCreateAPIToken()))
+	r.Handle("POST /tokens/{id}/revoke", app.RequireSessionLogin(app.RevokeAPIToken()))
 }
@@ -0,0 +1,34 @@
+package structs
+
+import (
+	"fmt"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+)
+
+// MaxCollectionDescriptionChars is the longest description a collection
+// can have.
+const MaxCollectionDescriptionChars = 2000
+
+type CollectionStruct struct {
+	Name        string `form:"name"`
+	Description string `form:"description"`
+	// Visibility is one of models.Visibilities.
+	Visibility          string     `form:"visibility"`
+	validator.Validator `form:"-"` // Exclude from form decoding
+}
+
+func (c *CollectionStruct) SetValidator(v validator.Validator) {
+	c.Validator = v
+}
+
+func (c *CollectionStruct) Validate() {
+	c.Validator = validator.New(CollectionStruct{})
+	c.CheckField(validator.NotBlank(c.Name), "Name", constants.ErrCannotBeBlank)
+	c.CheckField(validator.MaxChars(c.Name, 100), "Name", fmt.Sprintf(constants.ErrMaxChars, 100))
+	c.CheckField(validator.MaxChars(c.Description, MaxCollectionDescriptionChars), "Description",
+		fmt.Sprintf(constants.ErrMaxChars, MaxCollectionDescriptionChars))
+	c.CheckField(validator.PermittedValue(c.Visibility, models.Visibilities...), "Visibility",
+		"This field must equal public, unlisted or private")
+}
@@ -0,0 +1,77 @@
+package structs
+
+import (
+	"fmt"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+	"strconv"
+	"strings"
+)
+
+// MaxCommentChars is the longest comment that can be posted.
+const MaxCommentChars = 5000
+
+// LineCommentStruct is a review comment on lines of a snippet file, or a
+// reply to one when Thread is set.
+type LineCommentStruct struct {
+	File                string     `form:"file"`
+	Lines               string     `form:"lines"`
+	Thread              int        `form:"thread"`
+	Body                string     `form:"body"`
+	validator.Validator `form:"-"` // Exclude from form decoding
+}
+
+func (c *LineCommentStruct) SetValidator(v validator.Validator) {
+	c.Validator = v
+}
+
+func (c *LineCommentStruct) Validate() {
+	c.Validator = validator.New(LineCommentStruct{})
+	c.CheckField(validator.NotBlank(c.Body), "Body", constants.ErrCannotBeBlank)
+	c.CheckField(validator.MaxChars(c.Body, MaxCommentChars), "Body", fmt.Sprintf(constants.ErrMaxChars, MaxCommentChars))
+
+	if c.Thread == 0 {
+		start, end, ok := c.Range()
+		c.CheckField(validator.NotBlank(c.File), "File", constants.ErrCannotBeBlank)
+		c.CheckField(ok, "Lines", "This field must be a line number or a range like 10-25")
+		c.CheckField(!ok || end-start < models.MaxCommentLines, "Lines",
+			fmt.Sprintf("This field must cover at most %d lines", models.MaxCommentLines))
+	}
+}
+
+// Range parses Lines, which may be written "10", "10-25" or like the view
+// page anchors, "L10-L25".
+func (c *LineCommentStruct) Range() (start, end int, ok bool) {
+	first, last, isRange := strings.Cut(strings.TrimPrefix(strings.TrimSpace(c.Lines), "#"), "-")
+
+	start, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(first), "L"))
+	if err != nil || start < 1 {
+		return 0, 0, false
+	}
+	if !isRange {
+		return start, start, true
+	}
+
+	end, err = strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(last), "L"))
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// CommentStruct is a comment in the discussion under a snippet.
+type CommentStruct struct {
+	Body                string     `form:"body"`
+	validator.Validator `form:"-"` // Exclude from form decoding
+}
+
+func (c *CommentStruct) SetValidator(v validator.Validator) {
+	c.Validator = v
+}
+
+func (c *CommentStruct) Validate() {
+	c.Validator = validator.New(CommentStruct{})
+	c.CheckField(validator.NotBlank(c.Body), "Body", constants.ErrCannotBeBlank)
+	c.CheckField(validator.MaxChars(c.Body, MaxCommentChars), "Body", fmt.Sprintf(constants.ErrMaxChars, MaxCommentChars))
+}
@@ -0,0 +1,36 @@
+package structs
+
+import "testing"
+
+func TestLineCommentRange(t *testing.T) {
+	tests := []struct {
+		lines      string
+		start, end int
+		ok         bool
+	}{
+		{"10", 10, 10, true},
+		{"10-25", 10, 25, true},
+		{"L10-L25", 10, 25, true},
+		{"#L10-L25", 10, 25, true},
+		{"L7", 7, 7, true},
+		{" 10 - 25 ", 10, 25, true},
+		{"5-5", 5, 5, true},
+		{"", 0, 0, false},
+		{"0", 0, 0, false},
+		{"-5", 0, 0, false},
+		{"25-10", 0, 0, false},
+		{"10-", 0, 0, false},
+		{"10-x", 0, 0, false},
+		{"L", 0, 0, false},
+		{"10-20-30", 0, 0, false},
+		{"1.5", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		c := LineCommentStruct{Lines: tt.lines}
+		start, end, ok := c.Range()
+		if start != tt.start || end != tt.end || ok != tt.ok {
+			t.Errorf("Range(%q) = %d, %d, %t; want %d, %d, %t", tt.lines, start, end, ok, tt.start, tt.end, tt.ok)
+		}
+	}
+}
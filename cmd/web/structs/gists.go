@@ -0,0 +1,47 @@
+package structs
+
+import (
+	"fmt"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+	"strings"
+)
+
+// GistFileInput is one entry of the "files" object of a gist request. A nil
+// entry in an update deletes the file.
+type GistFileInput struct {
+	Content  *string `json:"content"`
+	Filename *string `json:"filename"`
+}
+
+// GistStruct is the body of a GitHub style create or update gist request.
+type GistStruct struct {
+	Description         *string                   `json:"description"`
+	Public              *bool                     `json:"public"`
+	Files               map[string]*GistFileInput `json:"files"`
+	validator.Validator `json:"-"`
+}
+
+// ValidateFiles checks the files a gist ends up with after a create or
+// update, using the same rules as the snippet form.
+func (g *GistStruct) ValidateFiles(title string, files []models.SnippetFile) {
+	g.Validator = validator.New(GistStruct{})
+	g.CheckField(validator.MaxChars(title, 100), "Description", fmt.Sprintf(constants.ErrMaxChars, 100))
+	g.CheckField(len(files) > 0, "Files", constants.ErrCannotBeBlank)
+	g.CheckField(len(files) <= MaxSnippetFiles, "Files", fmt.Sprintf("A gist can have at most %d files", MaxSnippetFiles))
+	if len(files) > MaxSnippetFiles {
+		// Not worth checking each of what may be thousands of files.
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, f := range files {
+		g.CheckField(validator.NotBlank(f.Filename), "Files", "Every file needs a name")
+		g.CheckField(validator.MaxChars(f.Filename, 255), "Files", fmt.Sprintf(constants.ErrMaxChars, 255))
+		g.CheckField(!strings.ContainsAny(f.Filename, `/\`), "Files", "File names cannot contain slashes")
+		g.CheckField(!seen[f.Filename], "Files", "File names must be unique")
+		g.CheckField(validator.NotBlank(f.Content), "Files", fmt.Sprintf("%s: %s", f.Filename, constants.ErrCannotBeBlank))
+		seen[f.Filename] = true
+	}
+}
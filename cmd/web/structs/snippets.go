@@ -3,24 +3,113 @@ package structs
 import (
 	"fmt"
 	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/models"
 	"snippetbox/internal/validator"
+	"strings"
 )
 
+// MaxSnippetFiles is the most files a single snippet may hold.
+const MaxSnippetFiles = 10
+
+// MaxSnippetImages is the most images that can be added when creating a
+// snippet.
+const MaxSnippetImages = 10
+
+type SnippetFileStruct struct {
+	Filename string `form:"filename"`
+	Language string `form:"language"`
+	Content  string `form:"content"`
+}
+
 type SnippetStruct struct {
-	Title               string     `form:"title"`
-	Content             string     `form:"content"`
-	Expires             int        `form:"expires"`
-	validator.Validator `form:"-"` // Exclude from form decoding
+	Title    string `form:"title" json:"title"`
+	Content  string `form:"content" json:"content"`
+	Language string `form:"language" json:"language"`
+	// Files is used by the HTML form, which can hold several files. Clients
+	// that only send Content and Language create a single file snippet.
+	Files   []SnippetFileStruct `form:"files" json:"-"`
+	Expires int                 `form:"expires" json:"expires"`
+	// Visibility is one of models.Visibilities. Left empty, new snippets are
+	// public and updated ones keep what they had.
+	Visibility string `form:"visibility" json:"visibility"`
+	// Images is how many images come with the snippet. A snippet made of
+	// images alone needs no text.
+	Images              int                 `form:"-" json:"-"`
+	validator.Validator `form:"-" json:"-"` // Exclude from form decoding
 }
 
 func (s *SnippetStruct) SetValidator(v validator.Validator) {
 	s.Validator = v
 }
 
+// DropBlankFiles removes files without a name or content, which the form
+// leaves behind when a file slot isn't used.
+func (s *SnippetStruct) DropBlankFiles() {
+	files := s.Files[:0]
+	for _, f := range s.Files {
+		if validator.NotBlank(f.Filename) || validator.NotBlank(f.Content) {
+			files = append(files, f)
+		}
+	}
+	s.Files = files
+}
+
+// VisibilityOr returns the chosen visibility, or fallback if none was.
+func (s *SnippetStruct) VisibilityOr(fallback string) string {
+	if s.Visibility == "" {
+		return fallback
+	}
+	return s.Visibility
+}
+
+// SnippetFiles returns the files to store for the snippet.
+func (s *SnippetStruct) SnippetFiles() []models.SnippetFile {
+	if len(s.Files) == 0 {
+		return []models.SnippetFile{{Content: s.Content, Language: s.Language}}
+	}
+
+	files := []models.SnippetFile{}
+	for _, f := range s.Files {
+		language := f.Language
+		if language == "" {
+			language = models.LanguageForFilename(f.Filename)
+		}
+		files = append(files, models.SnippetFile{Filename: strings.TrimSpace(f.Filename), Language: language, Content: f.Content})
+	}
+	return files
+}
+
 func (s *SnippetStruct) Validate() {
 	s.Validator = validator.New(SnippetStruct{})
 	s.CheckField(validator.NotBlank(s.Title), "Title", constants.ErrCannotBeBlank)
 	s.CheckField(validator.MaxChars(s.Title, 100), "Title", fmt.Sprintf(constants.ErrMaxChars, 100))
-	s.CheckField(validator.NotBlank(s.Content), "Content", constants.ErrCannotBeBlank)
 	s.CheckField(validator.PermittedValue(s.Expires, 1, 7, 365), "Expires", "This field must equal 1, 7 or 365")
+	s.CheckField(s.Visibility == "" || validator.PermittedValue(s.Visibility, models.Visibilities...), "Visibility",
+		"This field must equal public, unlisted or private")
+
+	s.CheckField(s.Images <= MaxSnippetImages, "Images", fmt.Sprintf("A snippet can have at most %d images", MaxSnippetImages))
+
+	if len(s.Files) == 0 {
+		s.CheckField(s.Images > 0 || validator.NotBlank(s.Content), "Content", constants.ErrCannotBeBlank)
+		s.CheckField(s.Language == "" || validator.Matches(s.Language, validator.LanguageRX), "Language", constants.ErrInvalidLanguage)
+		return
+	}
+
+	// Errors for the files of the form are keyed "Files.<index>.<Field>".
+	s.CheckField(len(s.Files) <= MaxSnippetFiles, "Files", fmt.Sprintf("A snippet can have at most %d files", MaxSnippetFiles))
+	seen := map[string]bool{}
+	for i, f := range s.Files {
+		key := fmt.Sprintf("Files.%d.", i)
+		name := strings.TrimSpace(f.Filename)
+
+		s.CheckField(validator.NotBlank(f.Content), key+"Content", constants.ErrCannotBeBlank)
+		s.CheckField(f.Language == "" || validator.Matches(f.Language, validator.LanguageRX), key+"Language", constants.ErrInvalidLanguage)
+		s.CheckField(validator.MaxChars(name, 255), key+"Filename", fmt.Sprintf(constants.ErrMaxChars, 255))
+		s.CheckField(!strings.ContainsAny(name, `/\`), key+"Filename", "File names cannot contain slashes")
+		s.CheckField(name == "" || !seen[name], key+"Filename", "File names must be unique")
+		if len(s.Files) > 1 {
+			s.CheckField(validator.NotBlank(name), key+"Filename", "Every file of a multi-file snippet needs a name")
+		}
+		seen[name] = true
+	}
 }
@@ -0,0 +1,28 @@
+package structs
+
+import (
+	"fmt"
+	"snippetbox/cmd/web/constants"
+	"snippetbox/internal/models"
+	"snippetbox/internal/validator"
+)
+
+type APITokenStruct struct {
+	Name                string     `form:"name"`
+	Scopes              []string   `form:"scopes"`
+	validator.Validator `form:"-"` // Exclude from form decoding
+}
+
+func (t *APITokenStruct) SetValidator(v validator.Validator) {
+	t.Validator = v
+}
+
+func (t *APITokenStruct) Validate() {
+	t.Validator = validator.New(APITokenStruct{})
+	t.CheckField(validator.NotBlank(t.Name), "Name", constants.ErrCannotBeBlank)
+	t.CheckField(validator.MaxChars(t.Name, 100), "Name", fmt.Sprintf(constants.ErrMaxChars, 100))
+	t.CheckField(len(t.Scopes) > 0, "Scopes", "Select at least one scope")
+	for _, scope := range t.Scopes {
+		t.CheckField(validator.PermittedValue(scope, models.Scopes...), "Scopes", "This field contains an unknown scope")
+	}
+}
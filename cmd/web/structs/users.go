@@ -21,6 +21,26 @@ type UserLogin struct {
 	validator.Validator `form:"-"`
 }
 
+// PasswordStruct is the form a logged in user changes their password with.
+type PasswordStruct struct {
+	CurrentPassword     string `form:"current_password"`
+	NewPassword         string `form:"new_password"`
+	ConfirmPassword     string `form:"confirm_password"`
+	validator.Validator `form:"-"`
+}
+
+func (p *PasswordStruct) SetValidator(v validator.Validator) {
+	p.Validator = v
+}
+
+func (p *PasswordStruct) Validate() {
+	p.Validator = validator.New(PasswordStruct{})
+	p.CheckField(validator.NotBlank(p.CurrentPassword), "CurrentPassword", constants.ErrCannotBeBlank)
+	p.CheckField(validator.NotBlank(p.NewPassword), "NewPassword", constants.ErrCannotBeBlank)
+	p.CheckField(validator.MinChars(p.NewPassword, 8), "NewPassword", fmt.Sprintf(constants.ErrMinChars, 8))
+	p.CheckField(p.NewPassword == p.ConfirmPassword, "ConfirmPassword", "This field must match the new password")
+}
+
 func (u *UserStruct) Validate() {
 	u.Validator = validator.New(UserStruct{})
 	u.Validator.CheckField(validator.NotBlank(u.Name), "Name", constants.ErrCannotBeBlank)
@@ -1,9 +1,13 @@
 package templates
 
 import (
+	"fmt"
 	"html/template"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"snippetbox/internal/models"
 	"time"
 )
 
@@ -12,23 +16,69 @@ import (
 // At the moment it only contains one field, but we'll add more
 // to it as the build progresses.
 type TemplateData[T any, M any] struct {
-	CurrentYear int
-	Flash       string
-	Form        *T
-	Data        M
+	CurrentYear     int
+	Flash           string
+	IsAuthenticated bool
+	CurrentUser     *models.User
+	Form            *T
+	Data            M
+	Meta            PageMeta
 }
 
+// PageMeta describes a page to search engines and to the sites that unfurl
+// links to it. Empty fields fall back to site wide defaults in the base
+// template.
+type PageMeta struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	// OEmbed is the oEmbed endpoint URL for the page, if it can be embedded.
+	OEmbed string
+	// NoIndex asks crawlers to leave the page alone, for pages that
+	// shouldn't turn up in searches.
+	NoIndex bool
+}
+
+// DefaultDescription is used by pages that don't describe themselves.
+const DefaultDescription = "Snippetbox is a place to paste, keep and share snippets of code."
+
 // Create a humanDate function which returns a nicely formatted string
 // representation of a time.Time object.
 func humanDate(t time.Time) string {
 	return t.Format("02 Jan 2006 at 15:04")
 }
 
+// byteSize formats a size in bytes for people, like "1.5 MB".
+func byteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// schemaName turns a JSON schema reference like "#/components/schemas/Snippet"
+// into the name of the schema.
+func schemaName(ref string) string {
+	return path.Base(ref)
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves.
 var functions = template.FuncMap{
-	"humanDate": humanDate,
+	"humanDate":  humanDate,
+	"byteSize":   byteSize,
+	"contains":   slices.Contains[[]string],
+	"schemaName": schemaName,
 }
 
 func NewTemplateCache() (map[string]*template.Template, error) {
@@ -8,7 +8,13 @@ require (
 	github.com/go-playground/form/v4 v4.2.1
 	github.com/go-sql-driver/mysql v1.9.1
 	github.com/lib/pq v1.10.9
-	golang.org/x/crypto v0.36.0
+	github.com/yuin/goldmark v1.8.6
+	golang.org/x/crypto v0.41.0
+	golang.org/x/image v0.30.0
+	golang.org/x/net v0.43.0
 )
 
-require filippo.io/edwards25519 v1.1.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+)
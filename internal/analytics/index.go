@@ -0,0 +1,179 @@
+// Package analytics counts snippet views in memory and hands them to a store
+// in batches, so viewing a snippet doesn't cost a database write.
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"log/slog"
+	"sync"
+	"time"
+
+	"snippetbox/internal/hyperloglog"
+)
+
+// Counts are the views of a snippet in one hour. Visitors is a sketch of who
+// viewed it, merged by the store into a sketch for the day. Sketches of
+// different days can't be merged into a count of unique visitors: the salt
+// changes every day, so someone who comes back counts again.
+type Counts struct {
+	SnippetID int
+	// Hour is when the hour started.
+	Hour     time.Time
+	Views    int
+	Visitors *hyperloglog.Sketch
+}
+
+// StoreFunc saves a batch of counts. Counts it fails to save are kept for
+// the next try.
+type StoreFunc func(ctx context.Context, batch []Counts) error
+
+type key struct {
+	snippetID int
+	hour      time.Time
+}
+
+// Recorder buffers views until they are flushed, every interval or as soon
+// as maxPending views are waiting.
+type Recorder struct {
+	store      StoreFunc
+	logger     *slog.Logger
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[key]*Counts
+	views   int
+	// Visitors are hashed with a salt that changes every day and is never
+	// stored, so neither the sketches nor anything else can tell whether
+	// the same person came back on another day.
+	salt    [32]byte
+	saltDay time.Time
+
+	full chan struct{}
+}
+
+func NewRecorder(store StoreFunc, logger *slog.Logger, maxPending int) *Recorder {
+	return &Recorder{
+		store:      store,
+		logger:     logger,
+		maxPending: maxPending,
+		pending:    map[key]*Counts{},
+		full:       make(chan struct{}, 1),
+	}
+}
+
+// Record counts a view of a snippet by the visitor with the given IP address
+// and user agent. Neither is kept.
+func (r *Recorder) Record(snippetID int, ip, userAgent string) {
+	now := time.Now().UTC()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if day := now.Truncate(24 * time.Hour); !day.Equal(r.saltDay) {
+		rand.Read(r.salt[:])
+		r.saltDay = day
+	}
+
+	k := key{snippetID, now.Truncate(time.Hour)}
+	c, ok := r.pending[k]
+	if !ok {
+		c = &Counts{SnippetID: snippetID, Hour: k.hour, Visitors: hyperloglog.New()}
+		r.pending[k] = c
+	}
+	c.Views++
+	c.Visitors.Add(r.visitorHash(ip, userAgent))
+
+	r.views++
+	if r.views >= r.maxPending {
+		select {
+		case r.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (r *Recorder) visitorHash(ip, userAgent string) uint64 {
+	h := sha256.New()
+	h.Write(r.salt[:])
+	h.Write([]byte(ip))
+	h.Write([]byte{0})
+	h.Write([]byte(userAgent))
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// Run flushes the buffered views every interval, and early when the buffer
+// fills up, until ctx is done. It flushes once more before returning.
+func (r *Recorder) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := r.Flush(context.Background()); err != nil {
+				r.logger.Error("Failed to save snippet views", "error", err)
+			}
+			return
+		case <-ticker.C:
+		case <-r.full:
+		}
+
+		if err := r.Flush(ctx); err != nil {
+			r.logger.Error("Failed to save snippet views", "error", err)
+		}
+	}
+}
+
+// Flush saves the buffered views. If the store fails they are put back to
+// be saved with the next batch, as far as the buffer allows.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = map[key]*Counts{}
+	r.views = 0
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	batch := make([]Counts, 0, len(pending))
+	for _, c := range pending {
+		batch = append(batch, *c)
+	}
+
+	err := r.store(ctx, batch)
+	if err != nil {
+		r.putBack(pending)
+	}
+
+	return err
+}
+
+// putBack returns counts that failed to save to the buffer. The views put
+// back don't count towards a full buffer, or a store that is down would be
+// retried on every view. While the store stays down the buffer would grow
+// without end, so counts beyond maxPending hours are dropped instead.
+func (r *Recorder) putBack(pending map[key]*Counts) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dropped := 0
+	for k, c := range pending {
+		if newer, ok := r.pending[k]; ok {
+			c.Views += newer.Views
+			c.Visitors.Merge(newer.Visitors)
+		} else if len(r.pending) >= r.maxPending {
+			dropped += c.Views
+			continue
+		}
+		r.pending[k] = c
+	}
+
+	if dropped > 0 {
+		r.logger.Warn("Dropped snippet views that could not be saved", "views", dropped)
+	}
+}
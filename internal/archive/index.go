@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// Formats maps the archive formats we can produce to their content type.
+var Formats = map[string]string{
+	"zip":    "application/zip",
+	"tar.gz": "application/gzip",
+}
+
+type File struct {
+	Name     string
+	Content  []byte
+	Modified time.Time
+}
+
+// Write streams the files to w as an archive in the given format, which must
+// be one of the keys of Formats.
+func Write(w io.Writer, format string, files []File) error {
+	aw := NewWriter(w, format)
+	for _, f := range files {
+		if err := aw.Add(f); err != nil {
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// Writer streams an archive one file at a time, so the files don't all have
+// to be held in memory at once.
+type Writer interface {
+	Add(f File) error
+	// Close finishes the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a Writer for an archive in the given format, which must be
+// one of the keys of Formats.
+func NewWriter(w io.Writer, format string) Writer {
+	if format == "tar.gz" {
+		gw := gzip.NewWriter(w)
+		return &tarGzWriter{gw: gw, tw: tar.NewWriter(gw)}
+	}
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+func WriteZip(w io.Writer, files []File) error {
+	return Write(w, "zip", files)
+}
+
+func WriteTarGz(w io.Writer, files []File) error {
+	return Write(w, "tar.gz", files)
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipWriter) Add(f File) error {
+	fw, err := a.zw.CreateHeader(&zip.FileHeader{
+		Name:     f.Name,
+		Method:   zip.Deflate,
+		Modified: f.Modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fw.Write(f.Content)
+	return err
+}
+
+func (a *zipWriter) Close() error {
+	return a.zw.Close()
+}
+
+type tarGzWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (a *tarGzWriter) Add(f File) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Name:    f.Name,
+		Mode:    0644,
+		Size:    int64(len(f.Content)),
+		ModTime: f.Modified,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = a.tw.Write(f.Content)
+	return err
+}
+
+func (a *tarGzWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+
+	return a.gw.Close()
+}
@@ -0,0 +1,99 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testStore runs the behaviour every BlobStore must have against s.
+func testStore(t *testing.T, s BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	get := func(key string) (string, error) {
+		t.Helper()
+		blob, err := s.Get(ctx, key)
+		if err != nil {
+			return "", err
+		}
+		defer blob.Close()
+		data, err := io.ReadAll(blob)
+		return string(data), err
+	}
+
+	if err := s.Put(ctx, "contents/one", strings.NewReader("first"), "text/plain"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got, err := get("contents/one"); err != nil || got != "first" {
+		t.Fatalf("Get = %q, %v; want %q", got, err, "first")
+	}
+
+	if err := s.Put(ctx, "contents/one", strings.NewReader("second"), "text/plain"); err != nil {
+		t.Fatalf("Put over existing blob: %v", err)
+	}
+	if got, err := get("contents/one"); err != nil || got != "second" {
+		t.Fatalf("Get after overwrite = %q, %v; want %q", got, err, "second")
+	}
+
+	if err := s.Put(ctx, "contents/empty", strings.NewReader(""), ""); err != nil {
+		t.Fatalf("Put of empty blob: %v", err)
+	}
+	if got, err := get("contents/empty"); err != nil || got != "" {
+		t.Fatalf("Get of empty blob = %q, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, "contents/one"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := get("contents/one"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: got %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "contents/one"); err != nil {
+		t.Fatalf("Delete of missing blob: %v", err)
+	}
+	if err := s.Delete(ctx, "contents/empty"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	for _, key := range []string{"", "/abs", "../escape", "a/../b", "a//b", "a/./b", ".hidden", "a b", "a\\b"} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), ""); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", key)
+		}
+		if _, err := s.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %v, want an invalid key error", key, err)
+		}
+		if err := s.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded, want an invalid key error", key)
+		}
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "blobs")
+
+	s, err := NewFileStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, s)
+
+	// Uploads go through temporary files, none of which may be left over.
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			t.Errorf("file left behind: %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
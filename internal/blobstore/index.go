@@ -0,0 +1,42 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blobstore: blob not found")
+
+// BlobStore stores opaque blobs under string keys. Keys are made of
+// slash-separated segments of letters, digits, dots, dashes and underscores.
+type BlobStore interface {
+	// Put stores the contents of r under key, replacing any existing blob.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens the blob stored under key. It returns ErrNotFound when there
+	// is no such blob.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is
+	// not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Options selects and configures a blob store. An S3 store is used when
+// S3Endpoint is set, the local disk below Dir otherwise.
+type Options struct {
+	Dir         string
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+}
+
+// Open returns the blob store described by the options.
+func Open(o Options) (BlobStore, error) {
+	if o.S3Endpoint != "" {
+		return NewS3Store(o.S3Endpoint, o.S3Bucket, o.S3Region, o.S3AccessKey, o.S3SecretKey)
+	}
+
+	return NewFileStore(o.Dir)
+}
@@ -0,0 +1,66 @@
+package codeimage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Cache keeps rendered images in memory, keyed by a hash of what they show,
+// and evicts the least recently used ones beyond a total size.
+type Cache struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	data []byte
+}
+
+func NewCache(maxBytes int) *Cache {
+	return &Cache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	return e.Value.(*cacheEntry).data, true
+}
+
+func (c *Cache) Put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(data) > c.maxBytes {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key, data})
+	c.size += len(data)
+
+	for c.size > c.maxBytes {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.size -= len(entry.data)
+	}
+}
@@ -0,0 +1,79 @@
+package codeimage
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+
+	"golang.org/x/image/font"
+)
+
+// Cards have the size link previews are shown at by most sites.
+const (
+	CardWidth  = 1200
+	CardHeight = 630
+	cardMargin = 56
+)
+
+// RenderCard writes a PNG preview card for link unfurls: the title above a
+// window with the start of the code. Whatever doesn't fit is cut off.
+func RenderCard(w io.Writer, title, code string) error {
+	f, err := loadFaces()
+	if err != nil {
+		return err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, CardWidth, CardHeight))
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+
+	metrics := f.regular.Metrics()
+	advance, _ := f.regular.GlyphAdvance('0')
+	charWidth := advance.Ceil()
+	lineHeight := metrics.Height.Ceil() * 3 / 2
+
+	// The title, then the site name in the bottom corner.
+	titleBaseline := cardMargin + metrics.Ascent.Ceil()
+	drawText(img, f.bold, titleColor, cardMargin, titleBaseline, fit(f.bold, title, CardWidth-cardMargin*2))
+	footer := "Snippetbox"
+	drawText(img, f.bold, lineNumberColor, CardWidth-cardMargin-font.MeasureString(f.bold, footer).Ceil(),
+		CardHeight-cardMargin+metrics.Ascent.Ceil()/2, footer)
+
+	window := image.Rect(cardMargin, titleBaseline+padding, CardWidth-cardMargin, CardHeight-cardMargin-lineHeight)
+	draw.DrawMask(img, window, image.NewUniform(windowColor), image.Point{},
+		&roundedRect{window, radius}, window.Min, draw.Over)
+
+	lines, _ := prepareLines(code)
+	visible := (window.Dy() - padding) / lineHeight
+	lines = lines[:min(len(lines), visible)]
+
+	gutter := len(strconv.Itoa(len(lines))) * charWidth
+	x := window.Min.X + padding
+	width := window.Max.X - padding - (x + gutter + charWidth*2)
+	for i, line := range lines {
+		baseline := window.Min.Y + padding/2 + i*lineHeight + (lineHeight+metrics.Ascent.Ceil()-metrics.Descent.Ceil())/2
+		number := strconv.Itoa(i + 1)
+		drawText(img, f.regular, lineNumberColor, x+gutter-len(number)*charWidth, baseline, number)
+		drawText(img, f.regular, textColor, x+gutter+charWidth*2, baseline, fit(f.regular, line, width))
+	}
+
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return encoder.Encode(w, img)
+}
+
+// fit cuts text to at most width pixels, marking the cut with an ellipsis.
+func fit(face font.Face, text string, width int) string {
+	if font.MeasureString(face, text).Ceil() <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if s := string(runes) + "…"; font.MeasureString(face, s).Ceil() <= width {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+// Package codeimage renders source code onto a PNG, for pasting code into
+// slides and chat tools that don't show text well.
+package codeimage
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Version changes whenever the output for the same input changes, so cached
+// images from an older renderer aren't served.
+const Version = "1"
+
+// Longer code is cut off, the image says how much was left out.
+const (
+	MaxLines   = 120
+	MaxColumns = 120
+	tabWidth   = 4
+)
+
+// Sizes in pixels. Text is drawn at twice the usual size so the image stays
+// sharp on high density screens and when scaled up on slides.
+const (
+	fontSize   = 28
+	margin     = 48
+	padding    = 40
+	headerSize = 72
+	radius     = 20
+)
+
+var (
+	backgroundColor = color.RGBA{0x1e, 0x21, 0x27, 0xff}
+	windowColor     = color.RGBA{0x28, 0x2c, 0x34, 0xff}
+	textColor       = color.RGBA{0xab, 0xb2, 0xbf, 0xff}
+	lineNumberColor = color.RGBA{0x5c, 0x63, 0x70, 0xff}
+	titleColor      = color.RGBA{0x9d, 0xa5, 0xb4, 0xff}
+	buttonColors    = []color.RGBA{{0xff, 0x5f, 0x57, 0xff}, {0xfe, 0xbc, 0x2e, 0xff}, {0x28, 0xc8, 0x40, 0xff}}
+)
+
+type faces struct {
+	regular, bold font.Face
+}
+
+// loadFaces parses the Go Mono fonts, which are compiled into the binary.
+var loadFaces = sync.OnceValues(func() (faces, error) {
+	var f faces
+
+	for _, typeface := range []struct {
+		ttf  []byte
+		face *font.Face
+	}{{gomono.TTF, &f.regular}, {gomonobold.TTF, &f.bold}} {
+		parsed, err := opentype.Parse(typeface.ttf)
+		if err != nil {
+			return faces{}, err
+		}
+		*typeface.face, err = opentype.NewFace(parsed, &opentype.FaceOptions{Size: fontSize, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return faces{}, err
+		}
+	}
+
+	return f, nil
+})
+
+// Render writes a PNG of the code with line numbers, in a window with the
+// title in its header.
+func Render(w io.Writer, title, code string) error {
+	f, err := loadFaces()
+	if err != nil {
+		return err
+	}
+
+	lines, omitted := prepareLines(code)
+
+	advance, _ := f.regular.GlyphAdvance('0')
+	charWidth := advance.Ceil()
+	metrics := f.regular.Metrics()
+	lineHeight := metrics.Height.Ceil() * 3 / 2
+
+	gutter := len(strconv.Itoa(len(lines))) * charWidth
+	columns := 0
+	for _, line := range lines {
+		columns = max(columns, utf8.RuneCountInString(line))
+	}
+	if omitted > 0 {
+		columns = max(columns, utf8.RuneCountInString(omittedText(omitted)))
+	}
+	titleWidth := font.MeasureString(f.bold, title).Ceil()
+
+	bodyLines := len(lines)
+	if omitted > 0 {
+		bodyLines++
+	}
+
+	windowWidth := max(padding*2+gutter+charWidth*2+columns*charWidth, titleWidth+240)
+	windowHeight := headerSize + padding + bodyLines*lineHeight + padding/2
+	img := image.NewRGBA(image.Rect(0, 0, windowWidth+margin*2, windowHeight+margin*2))
+
+	draw.Draw(img, img.Bounds(), image.NewUniform(backgroundColor), image.Point{}, draw.Src)
+	window := image.Rect(margin, margin, margin+windowWidth, margin+windowHeight)
+	draw.DrawMask(img, window, image.NewUniform(windowColor), image.Point{},
+		&roundedRect{window, radius}, window.Min, draw.Over)
+
+	// Window buttons and the title.
+	for i, c := range buttonColors {
+		center := image.Pt(window.Min.X+padding+i*36, window.Min.Y+headerSize/2)
+		dot := image.Rect(center.X-10, center.Y-10, center.X+10, center.Y+10)
+		draw.DrawMask(img, dot, image.NewUniform(c), image.Point{}, &roundedRect{dot, 10}, dot.Min, draw.Over)
+	}
+	baseline := window.Min.Y + (headerSize+metrics.Ascent.Ceil()-metrics.Descent.Ceil())/2
+	drawText(img, f.bold, titleColor, window.Min.X+(windowWidth-titleWidth)/2, baseline, title)
+
+	// The code, with right aligned line numbers.
+	x := window.Min.X + padding
+	y := window.Min.Y + headerSize + padding/2
+	for i, line := range lines {
+		baseline := y + i*lineHeight + (lineHeight+metrics.Ascent.Ceil()-metrics.Descent.Ceil())/2
+		number := strconv.Itoa(i + 1)
+		drawText(img, f.regular, lineNumberColor, x+gutter-len(number)*charWidth, baseline, number)
+		drawText(img, f.regular, textColor, x+gutter+charWidth*2, baseline, line)
+	}
+	if omitted > 0 {
+		baseline := y + len(lines)*lineHeight + (lineHeight+metrics.Ascent.Ceil()-metrics.Descent.Ceil())/2
+		drawText(img, f.regular, lineNumberColor, x+gutter+charWidth*2, baseline, omittedText(omitted))
+	}
+
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return encoder.Encode(w, img)
+}
+
+// prepareLines splits the code into lines ready to draw: tabs expanded,
+// control characters replaced and overlong lines cut. It also returns how
+// many lines didn't fit.
+func prepareLines(code string) ([]string, int) {
+	code = strings.TrimRight(strings.ReplaceAll(code, "\r\n", "\n"), "\n")
+	lines := strings.Split(code, "\n")
+
+	omitted := 0
+	if len(lines) > MaxLines {
+		omitted = len(lines) - MaxLines
+		lines = lines[:MaxLines]
+	}
+
+	for i, line := range lines {
+		var b strings.Builder
+		column := 0
+		for _, r := range line {
+			if column >= MaxColumns {
+				b.WriteRune('…')
+				break
+			}
+			switch {
+			case r == '\t':
+				n := tabWidth - column%tabWidth
+				b.WriteString(strings.Repeat(" ", n))
+				column += n
+				continue
+			case unicode.IsControl(r) || r == utf8.RuneError:
+				r = '·'
+			}
+			b.WriteRune(r)
+			column++
+		}
+		lines[i] = b.String()
+	}
+
+	return lines, omitted
+}
+
+func omittedText(n int) string {
+	if n == 1 {
+		return "… 1 more line"
+	}
+	return "… " + strconv.Itoa(n) + " more lines"
+}
+
+func drawText(dst draw.Image, face font.Face, c color.Color, x, y int, text string) {
+	d := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// roundedRect is a mask for a rectangle with rounded corners.
+type roundedRect struct {
+	r      image.Rectangle
+	radius int
+}
+
+func (m *roundedRect) ColorModel() color.Model { return color.AlphaModel }
+
+func (m *roundedRect) Bounds() image.Rectangle { return m.r }
+
+func (m *roundedRect) At(x, y int) color.Color {
+	// Distance from the nearest corner's circle center, if the point is in
+	// a corner square at all.
+	cx, cy := x, y
+	switch {
+	case x < m.r.Min.X+m.radius:
+		cx = m.r.Min.X + m.radius
+	case x >= m.r.Max.X-m.radius:
+		cx = m.r.Max.X - m.radius - 1
+	}
+	switch {
+	case y < m.r.Min.Y+m.radius:
+		cy = m.r.Min.Y + m.radius
+	case y >= m.r.Max.Y-m.radius:
+		cy = m.r.Max.Y - m.radius - 1
+	}
+
+	dx, dy := x-cx, y-cy
+	if dx*dx+dy*dy > m.radius*m.radius {
+		return color.Transparent
+	}
+	return color.Opaque
+}
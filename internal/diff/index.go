@@ -0,0 +1,230 @@
+// Package diff compares two texts line by line and groups the changes into
+// hunks with some unchanged lines around them, like a unified diff.
+package diff
+
+// Kind says whether a line is in both texts or only one of them.
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Line is a line of a diff. OldNumber and NewNumber are the line numbers in
+// each text, starting at 1, and 0 for a text the line isn't in.
+type Line struct {
+	Kind      Kind
+	Text      string
+	OldNumber int
+	NewNumber int
+}
+
+// Hunk is a run of changes and the lines around them.
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// maxEdits bounds the work and memory Lines uses, which grow with the square
+// of the number of edits. Texts further apart than that are shown as entirely
+// replaced past their common start and end, which is about as useful to a
+// reader anyway.
+const maxEdits = 2000
+
+// Lines returns the differences between two lists of lines as a shortest
+// edit script, found with Myers' algorithm.
+func Lines(a, b []string) []Line {
+	// The common start and end don't take part in the search.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	out := make([]Line, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		out = append(out, Line{Kind: Equal, Text: a[i], OldNumber: i + 1, NewNumber: i + 1})
+	}
+
+	for _, l := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if l.OldNumber > 0 {
+			l.OldNumber += prefix
+		}
+		if l.NewNumber > 0 {
+			l.NewNumber += prefix
+		}
+		out = append(out, l)
+	}
+
+	for i := 0; i < suffix; i++ {
+		oi, ni := len(a)-suffix+i, len(b)-suffix+i
+		out = append(out, Line{Kind: Equal, Text: a[oi], OldNumber: oi + 1, NewNumber: ni + 1})
+	}
+
+	return out
+}
+
+// myers finds a shortest edit script from a to b.
+func myers(a, b []string) []Line {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(a, b)
+	}
+
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+
+	for d := 0; d <= n+m; d++ {
+		if d > maxEdits {
+			return replace(a, b)
+		}
+		// Only diagonals -d to d can have been reached so far.
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, d)
+			}
+		}
+	}
+
+	return replace(a, b)
+}
+
+// backtrack walks the saved search frontiers back from the end of both texts
+// to recover the edits.
+func backtrack(a, b []string, trace [][]int, d int) []Line {
+	x, y := len(a), len(b)
+	var reversed []Line
+
+	for ; d > 0; d-- {
+		// trace[d] holds diagonals -d to d as they were before step d.
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || k != d && v[d+k-1] < v[d+k+1] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[d+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, Line{Kind: Equal, Text: a[x], OldNumber: x + 1, NewNumber: y + 1})
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, Line{Kind: Insert, Text: b[y], NewNumber: y + 1})
+		} else {
+			x--
+			reversed = append(reversed, Line{Kind: Delete, Text: a[x], OldNumber: x + 1})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, Line{Kind: Equal, Text: a[x], OldNumber: x + 1, NewNumber: y + 1})
+	}
+
+	lines := make([]Line, len(reversed))
+	for i, l := range reversed {
+		lines[len(reversed)-1-i] = l
+	}
+	return lines
+}
+
+// replace deletes all of a and inserts all of b.
+func replace(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	for i, s := range a {
+		lines = append(lines, Line{Kind: Delete, Text: s, OldNumber: i + 1})
+	}
+	for i, s := range b {
+		lines = append(lines, Line{Kind: Insert, Text: s, NewNumber: i + 1})
+	}
+	return lines
+}
+
+// Hunks groups the changes of a diff with up to context unchanged lines on
+// either side. Changes closer together than that share a hunk.
+func Hunks(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		start := max(i-context, 0)
+		// Extend past changes until context unchanged lines have followed
+		// the last one.
+		end := i
+		for j := i; j < len(lines) && j-end <= 2*context; j++ {
+			if lines[j].Kind != Equal {
+				end = j
+			}
+		}
+		stop := min(end+context+1, len(lines))
+
+		hunks = append(hunks, newHunk(lines[start:stop]))
+		i = stop
+	}
+
+	return hunks
+}
+
+func newHunk(lines []Line) Hunk {
+	h := Hunk{Lines: lines}
+	for _, l := range lines {
+		if l.OldNumber > 0 {
+			if h.OldStart == 0 {
+				h.OldStart = l.OldNumber
+			}
+			h.OldLines++
+		}
+		if l.NewNumber > 0 {
+			if h.NewStart == 0 {
+				h.NewStart = l.NewNumber
+			}
+			h.NewLines++
+		}
+	}
+	return h
+}
+
+// Stats counts the lines a diff adds and removes.
+func Stats(lines []Line) (additions, deletions int) {
+	for _, l := range lines {
+		switch l.Kind {
+		case Insert:
+			additions++
+		case Delete:
+			deletions++
+		}
+	}
+	return additions, deletions
+}
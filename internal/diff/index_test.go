@@ -0,0 +1,135 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// render writes a diff the way a unified diff shows its lines.
+func render(lines []Line) string {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteByte(" -+"[l.Kind])
+		b.WriteString(l.Text)
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "abc", "abc", " a b c"},
+		{"both empty", "", "", ""},
+		{"all inserted", "", "ab", "+a+b"},
+		{"all deleted", "ab", "", "-a-b"},
+		{"insert in the middle", "abc", "abxc", " a b+x c"},
+		{"delete at the start", "abc", "bc", "-a b c"},
+		{"replace at the end", "abc", "abx", " a b-c+x"},
+		{"edits between equal lines", "abcabba", "cbabac", "-a-b c+b a b-b a+c"},
+		{"repeated lines", "aaa", "aaaa", " a a a+a"},
+	}
+
+	for _, tt := range tests {
+		a, b := strings.Split(tt.a, ""), strings.Split(tt.b, "")
+		lines := Lines(a, b)
+		if got := render(lines); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		checkLines(t, tt.name, a, b, lines)
+	}
+}
+
+// checkLines checks that a diff turns a into b, numbering the lines of each.
+func checkLines(t *testing.T, name string, a, b []string, lines []Line) {
+	t.Helper()
+
+	var gotA, gotB []string
+	for _, l := range lines {
+		if l.Kind != Insert {
+			if l.OldNumber != len(gotA)+1 {
+				t.Errorf("%s: %q is old line %d, want %d", name, l.Text, l.OldNumber, len(gotA)+1)
+			}
+			gotA = append(gotA, l.Text)
+		} else if l.OldNumber != 0 {
+			t.Errorf("%s: inserted %q has old line %d", name, l.Text, l.OldNumber)
+		}
+		if l.Kind != Delete {
+			if l.NewNumber != len(gotB)+1 {
+				t.Errorf("%s: %q is new line %d, want %d", name, l.Text, l.NewNumber, len(gotB)+1)
+			}
+			gotB = append(gotB, l.Text)
+		} else if l.NewNumber != 0 {
+			t.Errorf("%s: deleted %q has new line %d", name, l.Text, l.NewNumber)
+		}
+	}
+
+	if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+		t.Errorf("%s: diff gives %q to %q", name, gotA, gotB)
+	}
+}
+
+func TestLinesTooFarApart(t *testing.T) {
+	// More than maxEdits changes between a common start and end are shown as
+	// a replacement.
+	var a, b []string
+	a = append(a, "start")
+	b = append(b, "start")
+	for i := range maxEdits {
+		a = append(a, fmt.Sprint("a", i))
+		b = append(b, fmt.Sprint("b", i))
+	}
+	a = append(a, "end")
+	b = append(b, "end")
+
+	lines := Lines(a, b)
+	checkLines(t, "too far apart", a, b, lines)
+
+	if lines[0].Kind != Equal || lines[len(lines)-1].Kind != Equal {
+		t.Error("common start and end not kept")
+	}
+	for i, l := range lines[1 : len(lines)-1] {
+		want := Delete
+		if i >= maxEdits {
+			want = Insert
+		}
+		if l.Kind != want {
+			t.Fatalf("line %d is %v, want %v", i+1, l.Kind, want)
+		}
+	}
+
+	additions, deletions := Stats(lines)
+	if additions != maxEdits || deletions != maxEdits {
+		t.Errorf("Stats = %d, %d; want %d, %d", additions, deletions, maxEdits, maxEdits)
+	}
+}
+
+func TestHunks(t *testing.T) {
+	a := strings.Split("abcdefghijklmnop", "")
+
+	tests := []struct {
+		name string
+		b    string
+		want []string
+	}{
+		{"no changes", "abcdefghijklmnop", nil},
+		{"one change", "abcdefgXhijklmnop", []string{"@@ -5,6 +5,7 @@  e f g+X h i j"}},
+		{"at the start", "Xbcdefghijklmnop", []string{"@@ -1,4 +1,4 @@ -a+X b c d"}},
+		{"at the end", "abcdefghijklmnoX", []string{"@@ -13,4 +13,4 @@  m n o-p+X"}},
+		{"close together", "abcXefgYijklmnop", []string{"@@ -1,11 +1,11 @@  a b c-d+X e f g-h+Y i j k"}},
+		{"far apart", "aXcdefghijklmnYp", []string{"@@ -1,5 +1,5 @@  a-b+X c d e", "@@ -12,5 +12,5 @@  l m n-o+Y p"}},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, h := range Hunks(Lines(a, strings.Split(tt.b, "")), 3) {
+			got = append(got, fmt.Sprintf("@@ -%d,%d +%d,%d @@ %s", h.OldStart, h.OldLines, h.NewStart, h.NewLines, render(h.Lines)))
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package highlight colours source code for the view pages. It knows the
+// comments, strings, numbers and keywords of common languages, which is all
+// most snippets need, and marks them with classes styled by the site CSS.
+package highlight
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// Classes given to the parts of the code.
+const (
+	Keyword = "hl-k"
+	Literal = "hl-l"
+	String  = "hl-s"
+	Comment = "hl-c"
+	Number  = "hl-n"
+)
+
+// Supported reports whether there is anything to colour in the language.
+func Supported(language string) bool {
+	return lookup(language) != nil
+}
+
+// HTML returns the code escaped and coloured for the language. Unknown
+// languages are only escaped.
+func HTML(language, code string) template.HTML {
+	return template.HTML(strings.Join(highlight(language, code), "\n"))
+}
+
+// Lines is HTML split into lines, with no markup spanning two of them, so each
+// line can be shown on its own. A final newline doesn't start another line.
+func Lines(language, code string) []template.HTML {
+	lines := highlight(language, strings.TrimSuffix(code, "\n"))
+	out := make([]template.HTML, len(lines))
+	for i, line := range lines {
+		out[i] = template.HTML(line)
+	}
+	return out
+}
+
+func highlight(language, code string) []string {
+	w := &writer{}
+	if l := lookup(language); l != nil {
+		tokenize(l, code, w.write)
+	} else {
+		w.write("", code)
+	}
+	return w.finish()
+}
+
+// writer collects marked up lines, closing and reopening spans at line ends.
+type writer struct {
+	lines []string
+	line  strings.Builder
+}
+
+func (w *writer) write(class, text string) {
+	for {
+		part, rest, more := strings.Cut(text, "\n")
+		if part != "" {
+			if class != "" {
+				w.line.WriteString(`<span class="` + class + `">` + html.EscapeString(part) + `</span>`)
+			} else {
+				w.line.WriteString(html.EscapeString(part))
+			}
+		}
+		if !more {
+			return
+		}
+		w.lines = append(w.lines, w.line.String())
+		w.line.Reset()
+		text = rest
+	}
+}
+
+func (w *writer) finish() []string {
+	return append(w.lines, w.line.String())
+}
+
+// tokenize splits code into classed tokens. Runs of anything else are passed
+// on with an empty class.
+func tokenize(l *language, code string, emit func(class, text string)) {
+	plain := 0
+	flush := func(i int) {
+		if i > plain {
+			emit("", code[plain:i])
+		}
+	}
+
+	for i := 0; i < len(code); {
+		class, n := l.token(code, i)
+		if n == 0 {
+			// Skip the rest of a word so keywords and numbers are only
+			// found at word starts.
+			n = 1
+			if isWord(code[i]) {
+				for i+n < len(code) && isWord(code[i+n]) {
+					n++
+				}
+			}
+			i += n
+			continue
+		}
+
+		flush(i)
+		emit(class, code[i:i+n])
+		i += n
+		plain = i
+	}
+	flush(len(code))
+}
+
+// token returns the class and length of the token at code[i], or a zero
+// length when there is none.
+func (l *language) token(code string, i int) (string, int) {
+	rest := code[i:]
+
+	for _, prefix := range l.lineComments {
+		if strings.HasPrefix(rest, prefix) {
+			return Comment, lineLength(rest)
+		}
+	}
+	if l.hashComments && rest[0] == '#' && (i == 0 || isSpace(code[i-1])) {
+		return Comment, lineLength(rest)
+	}
+	for _, pair := range l.blockComments {
+		if strings.HasPrefix(rest, pair[0]) {
+			end := strings.Index(rest[len(pair[0]):], pair[1])
+			if end < 0 {
+				return Comment, len(rest)
+			}
+			return Comment, len(pair[0]) + end + len(pair[1])
+		}
+	}
+
+	for _, s := range l.strings {
+		if strings.HasPrefix(rest, s.delimiter) {
+			return String, s.length(rest)
+		}
+	}
+
+	if i > 0 && isWord(code[i-1]) {
+		return "", 0
+	}
+
+	if rest[0] >= '0' && rest[0] <= '9' {
+		n := 1
+		for n < len(rest) && (isWord(rest[n]) || rest[n] == '.' && n+1 < len(rest) && isDigit(rest[n+1])) {
+			n++
+		}
+		return Number, n
+	}
+
+	if isWord(rest[0]) {
+		n := 1
+		for n < len(rest) && isWord(rest[n]) {
+			n++
+		}
+		word := rest[:n]
+		if l.caseless {
+			word = strings.ToLower(word)
+		}
+		switch {
+		case l.keywords[word]:
+			return Keyword, n
+		case l.literals[word]:
+			return Literal, n
+		}
+	}
+
+	return "", 0
+}
+
+// length returns how long the string starting at s is. Unterminated strings
+// run to the end of the line, or of the code for multiline ones.
+func (s stringStyle) length(text string) int {
+	for n := len(s.delimiter); n < len(text); n++ {
+		switch {
+		case s.escapes && text[n] == '\\':
+			n++
+		case text[n] == '\n' && !s.multiline:
+			return n
+		case strings.HasPrefix(text[n:], s.delimiter):
+			return n + len(s.delimiter)
+		}
+	}
+	return len(text)
+}
+
+func lineLength(s string) int {
+	if n := strings.IndexByte(s, '\n'); n >= 0 {
+		return n
+	}
+	return len(s)
+}
+
+func isWord(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,184 @@
+package highlight
+
+import "strings"
+
+// language describes just enough of a language's syntax to colour it.
+type language struct {
+	keywords map[string]bool
+	literals map[string]bool
+	// caseless languages match keywords whatever their case.
+	caseless      bool
+	lineComments  []string
+	blockComments [][2]string
+	// hashComments only start a comment at the start of a word, so that
+	// shell constructs like $# aren't taken for one.
+	hashComments bool
+	strings      []stringStyle
+}
+
+type stringStyle struct {
+	delimiter string
+	escapes   bool
+	multiline bool
+}
+
+func words(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cComments    = [][2]string{{"/*", "*/"}}
+	doubleQuoted = stringStyle{delimiter: `"`, escapes: true}
+	singleQuoted = stringStyle{delimiter: `'`, escapes: true}
+)
+
+var cLike = language{
+	keywords: words(`auto break case char const continue default do double else enum extern float for goto if inline int
+		long register restrict return short signed sizeof static struct switch typedef union unsigned void volatile while
+		bool class delete explicit friend namespace new operator private protected public template this throw try catch
+		typename using virtual nullptr constexpr noexcept override final`),
+	literals:      words(`true false NULL`),
+	lineComments:  []string{"//"},
+	blockComments: cComments,
+	strings:       []stringStyle{doubleQuoted, singleQuoted},
+}
+
+var languages = map[string]*language{
+	"go": {
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if import
+			interface map package range return select struct switch type var`),
+		literals:      words(`true false nil iota`),
+		lineComments:  []string{"//"},
+		blockComments: cComments,
+		strings:       []stringStyle{doubleQuoted, singleQuoted, {delimiter: "`", multiline: true}},
+	},
+	"python": {
+		keywords: words(`and as assert async await break class continue def del elif else except finally for from global
+			if import in is lambda nonlocal not or pass raise return try while with yield match case`),
+		literals:     words(`True False None self`),
+		hashComments: true,
+		strings: []stringStyle{
+			{delimiter: `"""`, escapes: true, multiline: true}, {delimiter: `'''`, escapes: true, multiline: true},
+			doubleQuoted, singleQuoted,
+		},
+	},
+	"javascript": {
+		keywords: words(`async await break case catch class const continue debugger default delete do else export
+			extends finally for from function if import in instanceof let new of return static super switch this throw
+			try typeof var void while with yield interface type enum implements private protected public readonly as`),
+		literals:      words(`true false null undefined NaN Infinity`),
+		lineComments:  []string{"//"},
+		blockComments: cComments,
+		strings:       []stringStyle{doubleQuoted, singleQuoted, {delimiter: "`", escapes: true, multiline: true}},
+	},
+	"java": {
+		keywords: words(`abstract assert break case catch class const continue default do else enum extends final
+			finally for goto if implements import instanceof interface native new package private protected public
+			return static strictfp super switch synchronized this throw throws transient try var void volatile while
+			boolean byte char double float int long short record`),
+		literals:      words(`true false null`),
+		lineComments:  []string{"//"},
+		blockComments: cComments,
+		strings:       []stringStyle{{delimiter: `"""`, escapes: true, multiline: true}, doubleQuoted, singleQuoted},
+	},
+	"c":   &cLike,
+	"cpp": &cLike,
+	"rust": {
+		keywords: words(`as async await break const continue crate dyn else enum extern fn for if impl in let loop
+			match mod move mut pub ref return self Self static struct super trait type unsafe use where while`),
+		literals:      words(`true false None Some Ok Err`),
+		lineComments:  []string{"//"},
+		blockComments: cComments,
+		// Single quotes also mark lifetimes, so only double quoted strings
+		// are coloured.
+		strings: []stringStyle{{delimiter: `"`, escapes: true, multiline: true}},
+	},
+	"ruby": {
+		keywords: words(`alias and begin break case class def defined? do else elsif end ensure for if in module next
+			not or redo rescue retry return self super then undef unless until when while yield require attr_accessor`),
+		literals:     words(`true false nil`),
+		hashComments: true,
+		strings:      []stringStyle{doubleQuoted, singleQuoted},
+	},
+	"bash": {
+		keywords: words(`if then else elif fi case esac for select while until do done in function time return exit
+			export local readonly declare set unset source echo cd`),
+		literals:     words(`true false`),
+		hashComments: true,
+		strings:      []stringStyle{{delimiter: `"`, escapes: true, multiline: true}, {delimiter: `'`, multiline: true}},
+	},
+	"sql": {
+		keywords: words(`select from where and or not insert into values update set delete create table alter drop
+			index primary key foreign references join left right inner outer full on as group by order having limit
+			offset union all distinct case when then else end is in exists between like returning with default
+			constraint unique check begin commit rollback transaction if cascade serial integer text varchar boolean
+			timestamp bigint char`),
+		literals:      words(`null true false`),
+		caseless:      true,
+		lineComments:  []string{"--"},
+		blockComments: cComments,
+		strings:       []stringStyle{{delimiter: `'`, multiline: true}, {delimiter: `"`}},
+	},
+	"json": {
+		literals: words(`true false null`),
+		strings:  []stringStyle{doubleQuoted},
+	},
+	"yaml": {
+		literals:     words(`true false null yes no on off`),
+		hashComments: true,
+		strings:      []stringStyle{doubleQuoted, {delimiter: `'`}},
+	},
+	"css": {
+		blockComments: cComments,
+		strings:       []stringStyle{doubleQuoted, singleQuoted},
+	},
+	"html": {
+		blockComments: [][2]string{{"<!--", "-->"}},
+		strings:       []stringStyle{{delimiter: `"`}, {delimiter: `'`}},
+	},
+	"dockerfile": {
+		keywords: words(`FROM RUN CMD LABEL EXPOSE ENV ADD COPY ENTRYPOINT VOLUME USER WORKDIR ARG ONBUILD
+			STOPSIGNAL HEALTHCHECK SHELL AS`),
+		hashComments: true,
+		strings:      []stringStyle{doubleQuoted, singleQuoted},
+	},
+}
+
+// aliases maps other names languages go by, like the short ones common after
+// Markdown code fences, to the names above.
+var aliases = map[string]string{
+	"golang":     "go",
+	"py":         "python",
+	"js":         "javascript",
+	"jsx":        "javascript",
+	"ts":         "javascript",
+	"tsx":        "javascript",
+	"typescript": "javascript",
+	"json5":      "json",
+	"c++":        "cpp",
+	"cc":         "cpp",
+	"h":          "c",
+	"rs":         "rust",
+	"rb":         "ruby",
+	"sh":         "bash",
+	"shell":      "bash",
+	"zsh":        "bash",
+	"console":    "bash",
+	"yml":        "yaml",
+	"xml":        "html",
+	"postgresql": "sql",
+	"psql":       "sql",
+	"docker":     "dockerfile",
+}
+
+func lookup(name string) *language {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	return languages[name]
+}
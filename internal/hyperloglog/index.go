@@ -0,0 +1,87 @@
+// Package hyperloglog estimates how many distinct items were seen without
+// keeping them. A sketch is a fixed 4 KiB whatever the count, estimates are
+// typically within 2% and sketches of different periods can be merged to
+// count the distinct items of them all.
+package hyperloglog
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// precision is the number of hash bits that pick a register.
+const (
+	precision = 12
+	registers = 1 << precision
+)
+
+// ErrInvalidSketch is returned when decoding bytes that aren't a sketch.
+var ErrInvalidSketch = errors.New("hyperloglog: invalid sketch")
+
+// Sketch is a HyperLogLog sketch. The zero value is not usable, use New.
+type Sketch struct {
+	registers []uint8
+}
+
+func New() *Sketch {
+	return &Sketch{registers: make([]uint8, registers)}
+}
+
+// FromBytes decodes a sketch stored with Bytes.
+func FromBytes(b []byte) (*Sketch, error) {
+	if len(b) != registers {
+		return nil, ErrInvalidSketch
+	}
+
+	return &Sketch{registers: append([]uint8(nil), b...)}, nil
+}
+
+// Bytes returns the sketch for storage.
+func (s *Sketch) Bytes() []byte {
+	return append([]byte(nil), s.registers...)
+}
+
+// Add records an item by its 64 bit hash, which must be uniformly
+// distributed.
+func (s *Sketch) Add(hash uint64) {
+	i := hash >> (64 - precision)
+	// The guard bit caps the rank when the remaining bits are all zero.
+	rank := uint8(bits.LeadingZeros64(hash<<precision|1<<(precision-1)) + 1)
+	if rank > s.registers[i] {
+		s.registers[i] = rank
+	}
+}
+
+// Merge adds every item recorded in other to s.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.registers {
+		if r > s.registers[i] {
+			s.registers[i] = r
+		}
+	}
+}
+
+// Estimate returns the estimated number of distinct items recorded.
+func (s *Sketch) Estimate() uint64 {
+	m := float64(registers)
+
+	sum, zeros := 0.0, 0
+	for _, r := range s.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Small counts leave registers empty, which linear counting estimates
+	// better from.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
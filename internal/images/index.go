@@ -0,0 +1,154 @@
+// Package images validates uploaded images, removes their metadata and
+// makes thumbnails of them.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// MaxPixels caps the dimensions of an image, so a small file can't decode to
+// gigabytes of pixels.
+const MaxPixels = 40_000_000
+
+// Thumbnails fit in a box of this size.
+const (
+	ThumbnailWidth  = 320
+	ThumbnailHeight = 240
+)
+
+var (
+	ErrUnsupported = errors.New("images: not a PNG, JPEG or GIF image")
+	ErrTooLarge    = errors.New("images: image dimensions are too large")
+)
+
+// ContentTypes maps the formats we accept to their media types.
+var ContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+}
+
+type Image struct {
+	// Data is the image with any metadata removed.
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	// Thumbnail is a PNG scaled down to fit ThumbnailWidth by ThumbnailHeight.
+	Thumbnail []byte
+}
+
+// Process decodes data to check it really is an image in one of the accepted
+// formats, strips metadata such as EXIF and makes a thumbnail.
+func Process(data []byte) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if _, ok := ContentTypes[format]; !ok {
+		return nil, ErrUnsupported
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img := &Image{ContentType: ContentTypes[format], Width: config.Width, Height: config.Height}
+	var decoded image.Image
+
+	switch format {
+	case "png":
+		decoded, err = png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		img.Data, err = stripPNG(data)
+	case "jpeg":
+		decoded, err = jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+
+		// Dropping the EXIF data would lose the orientation photos rely on,
+		// so those are rotated for real and encoded again.
+		if orientation := jpegOrientation(data); orientation > 1 && orientation <= 8 {
+			decoded = orient(decoded, orientation)
+			img.Width, img.Height = decoded.Bounds().Dx(), decoded.Bounds().Dy()
+
+			var buf bytes.Buffer
+			err = jpeg.Encode(&buf, decoded, &jpeg.Options{Quality: 90})
+			img.Data = buf.Bytes()
+		} else {
+			img.Data, err = stripJPEG(data)
+		}
+	case "gif":
+		// Decoding allocates every frame, so they are counted first: a small
+		// file can hold thousands of well compressed full size frames.
+		maxFrames := 4 * MaxPixels / max(config.Width*config.Height, 1)
+		if gifFrames(data, maxFrames) > maxFrames {
+			return nil, ErrTooLarge
+		}
+
+		var g *gif.GIF
+		g, err = gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+		}
+		decoded = gifFrame(g)
+
+		// Encoding the frames again keeps the animation and drops comments
+		// and application extensions.
+		var buf bytes.Buffer
+		err = gif.EncodeAll(&buf, g)
+		img.Data = buf.Bytes()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img.Thumbnail, err = thumbnail(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// gifFrame returns the first frame of an animation drawn on its full canvas.
+func gifFrame(g *gif.GIF) image.Image {
+	canvas := image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	return canvas
+}
+
+// thumbnail scales img down to fit the thumbnail box, keeping its aspect
+// ratio. Images that already fit are not enlarged.
+func thumbnail(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w > ThumbnailWidth {
+		w, h = ThumbnailWidth, max(1, h*ThumbnailWidth/w)
+	}
+	if h > ThumbnailHeight {
+		w, h = max(1, w*ThumbnailHeight/h), ThumbnailHeight
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
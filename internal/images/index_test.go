@@ -0,0 +1,82 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestProcessJPEG(t *testing.T) {
+	plain := testJPEG(t)
+	exif := func(orientation uint16) []byte {
+		return jpegSegment(0xe1, "Exif\x00\x00"+string(exifTIFF(binary.BigEndian, orientation))+"GPS")
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+	}{
+		{"plain", plain, 16, 8},
+		{"EXIF", withSegments(plain, exif(1)), 16, 8},
+		{"EXIF after the image", append(append([]byte{}, plain...), withSegments(plain, exif(1))...), 16, 8},
+		{"rotated", withSegments(plain, exif(6)), 8, 16},
+	}
+
+	for _, tt := range tests {
+		img, err := Process(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if img.Width != tt.width || img.Height != tt.height {
+			t.Errorf("%s: got %dx%d, want %dx%d", tt.name, img.Width, img.Height, tt.width, tt.height)
+		}
+		if bytes.Contains(img.Data, []byte("Exif")) || bytes.Contains(img.Data, []byte("GPS")) {
+			t.Errorf("%s: EXIF data left in the image", tt.name)
+		}
+		if img.ContentType != "image/jpeg" || len(img.Thumbnail) == 0 {
+			t.Errorf("%s: got %s with a %d byte thumbnail", tt.name, img.ContentType, len(img.Thumbnail))
+		}
+	}
+}
+
+func TestProcessGIF(t *testing.T) {
+	// A 1000x1000 canvas allows 4*MaxPixels/1e6 = 160 frames. Tiny frames
+	// compress to next to nothing but would each decode to a full canvas.
+	tests := []struct {
+		name   string
+		frames int
+		err    error
+	}{
+		{"animation", 3, nil},
+		{"at the frame limit", 160, nil},
+		{"over the frame limit", 161, ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		img, err := Process(testGIF(t, tt.frames, 1000, 1000, 1, false))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && (img.Width != 1000 || img.Height != 1000 || img.ContentType != "image/gif") {
+			t.Errorf("%s: got %dx%d %s", tt.name, img.Width, img.Height, img.ContentType)
+		}
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	tests := map[string][]byte{
+		"text":         []byte("hello"),
+		"cut short":    testJPEG(t)[:40],
+		"empty canvas": testGIF(t, 1, 0, 0, 0, false),
+	}
+
+	for name, data := range tests {
+		if _, err := Process(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+)
+
+var errMalformed = errors.New("images: malformed image data")
+
+// pngKeep lists the ancillary PNG chunks that affect how an image looks.
+// Every other ancillary chunk, text and EXIF ones included, is dropped.
+// Critical chunks are always kept.
+var pngKeep = map[string]bool{
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true, "sBIT": true,
+	"bKGD": true, "pHYs": true, "acTL": true, "fcTL": true, "fdAT": true,
+}
+
+// stripPNG removes metadata chunks from a PNG without decoding it again.
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, errMalformed
+	}
+
+	out := append([]byte{}, signature...)
+
+	for rest := data[len(signature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errMalformed
+		}
+		length := binary.BigEndian.Uint32(rest)
+		if uint64(length)+12 > uint64(len(rest)) {
+			return nil, errMalformed
+		}
+
+		chunk, kind := rest[:length+12], string(rest[4:8])
+		rest = rest[length+12:]
+
+		// A lower case first letter marks an ancillary chunk.
+		if kind[0] < 'a' || pngKeep[kind] {
+			out = append(out, chunk...)
+		}
+		if kind == "IEND" {
+			break
+		}
+	}
+
+	return out, nil
+}
+
+// gifFrames counts the frames of a GIF by walking its blocks, without
+// decoding any of them. Counting stops once there are more than limit, and
+// at the first block that is cut short, which the decoder then rejects.
+func gifFrames(data []byte, limit int) int {
+	if len(data) < 13 || !bytes.HasPrefix(data, []byte("GIF")) {
+		return 0
+	}
+
+	// The header, the logical screen descriptor and its colour table.
+	rest := data[13:]
+	if flags := data[10]; flags&0x80 != 0 {
+		rest = skip(rest, 3<<(flags&0x07+1))
+	}
+
+	frames := 0
+	for len(rest) > 0 && frames <= limit {
+		switch rest[0] {
+		case 0x21:
+			// An extension: its label, then data sub-blocks.
+			rest = skipGIFSubBlocks(skip(rest, 2))
+		case 0x2c:
+			// An image descriptor, its local colour table, the LZW minimum
+			// code size and the image data sub-blocks.
+			if len(rest) < 10 {
+				return frames
+			}
+			flags := rest[9]
+			rest = rest[10:]
+			if flags&0x80 != 0 {
+				rest = skip(rest, 3<<(flags&0x07+1))
+			}
+			rest = skipGIFSubBlocks(skip(rest, 1))
+			frames++
+		default:
+			// The trailer, or something the decoder won't accept either.
+			return frames
+		}
+	}
+
+	return frames
+}
+
+// skipGIFSubBlocks skips a sequence of GIF data sub-blocks, each starting
+// with its size, up to and including the empty block that ends it.
+func skipGIFSubBlocks(rest []byte) []byte {
+	for len(rest) > 0 {
+		size := int(rest[0])
+		rest = skip(rest, size+1)
+		if size == 0 {
+			break
+		}
+	}
+	return rest
+}
+
+// skip drops the first n bytes of b, or all of them if b is shorter.
+func skip(b []byte, n int) []byte {
+	return b[min(n, len(b)):]
+}
+
+// jpegKeep lists the application segments that affect how a JPEG looks: JFIF
+// (APP0), ICC profiles (APP2) and Adobe colour transforms (APP14). EXIF and
+// XMP (APP1), IPTC (APP13), the others and comments are dropped.
+var jpegKeep = map[byte]bool{0xe0: true, 0xe2: true, 0xee: true}
+
+// stripJPEG removes metadata segments from a JPEG without decoding it again.
+// Segments between scans are filtered like those before the first one, and
+// the image ends at its EOI marker: whatever follows it, such as the extra
+// pictures with their own EXIF that phones append, is dropped.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errMalformed
+	}
+
+	out := []byte{0xff, 0xd8}
+	scanned := false
+
+	for rest := data[2:]; ; {
+		// A file cut short after its image data decodes all the same, so it
+		// is kept and closed properly.
+		if len(rest) == 0 && scanned {
+			return append(out, 0xff, 0xd9), nil
+		}
+		if len(rest) < 2 || rest[0] != 0xff {
+			return nil, errMalformed
+		}
+		marker := rest[1]
+
+		// Fill bytes and markers without a payload.
+		if marker == 0xff {
+			rest = rest[1:]
+			continue
+		}
+		if marker == 0x01 || marker >= 0xd0 && marker <= 0xd7 {
+			out = append(out, rest[:2]...)
+			rest = rest[2:]
+			continue
+		}
+		if marker == 0xd9 {
+			return append(out, 0xff, 0xd9), nil
+		}
+
+		if len(rest) < 4 {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint16(rest[2:]))
+		if length < 2 || length+2 > len(rest) {
+			return nil, errMalformed
+		}
+
+		segment := rest[:length+2]
+		rest = rest[length+2:]
+
+		isMetadata := marker == 0xfe || marker >= 0xe0 && marker <= 0xef && !jpegKeep[marker]
+		if !isMetadata {
+			out = append(out, segment...)
+		}
+
+		// A start of scan header is followed by the image data, which runs
+		// up to the next marker.
+		if marker == 0xda {
+			n := jpegScanLength(rest)
+			out = append(out, rest[:n]...)
+			rest = rest[n:]
+			scanned = true
+		}
+	}
+}
+
+// jpegScanLength returns the length of the entropy coded data at the start of
+// b. It ends at the first marker other than a stuffed 0xff byte or a restart
+// marker, or at the end of b.
+func jpegScanLength(b []byte) int {
+	for i := 0; i+1 < len(b); i++ {
+		if b[i] != 0xff {
+			continue
+		}
+		if next := b[i+1]; next != 0x00 && (next < 0xd0 || next > 0xd7) {
+			return i
+		}
+		i++
+	}
+	return len(b)
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG, from 1 to 8, or 0
+// when there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return 0
+	}
+
+	for rest := data[2:]; len(rest) >= 4 && rest[0] == 0xff; {
+		marker := rest[1]
+		if marker == 0xda || marker == 0xd9 {
+			return 0
+		}
+
+		length := int(binary.BigEndian.Uint16(rest[2:]))
+		if length < 2 || length+2 > len(rest) {
+			return 0
+		}
+		payload := rest[4 : length+2]
+		rest = rest[length+2:]
+
+		if marker == 0xe1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+			return exifOrientation(payload[6:])
+		}
+	}
+
+	return 0
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := range count {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 0
+}
+
+// orient turns an image stored with the given EXIF orientation the right way
+// up.
+func orient(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,313 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// testJPEG encodes a small JPEG, which the standard library writes without
+// any application segments.
+func testJPEG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := range 8 {
+		for x := range 16 {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 32), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// jpegSegment builds a marker segment with its length.
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifTIFF builds the TIFF structure of an EXIF segment holding only an
+// orientation tag, in the given byte order.
+func exifTIFF(order binary.AppendByteOrder, orientation uint16) []byte {
+	mark := "II"
+	if order.AppendUint16(nil, 1)[0] == 0 {
+		mark = "MM"
+	}
+	tiff := order.AppendUint16([]byte(mark), 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = order.AppendUint16(tiff, 0)
+	return order.AppendUint32(tiff, 0)
+}
+
+// withSegments inserts segments right after the start of image marker.
+func withSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	plain := testJPEG(t)
+	exif := jpegSegment(0xe1, "Exif\x00\x00GPSLatitude 51.5")
+	jfif := jpegSegment(0xe0, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	icc := jpegSegment(0xe2, "ICC_PROFILE\x00\x01\x01profile")
+	adobe := jpegSegment(0xee, "Adobe\x00\x64\x00\x00\x00\x00\x01")
+
+	// A second picture after the end of the first, as phones append for
+	// multi-picture and motion photos, with its own EXIF.
+	trailer := withSegments(plain, jpegSegment(0xe2, "MPF\x00"), exif)
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"plain", plain, plain},
+		{"metadata", withSegments(plain, jfif, exif, jpegSegment(0xe1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"),
+			icc, jpegSegment(0xed, "Photoshop 3.0\x00IPTC"), jpegSegment(0xfe, "a comment"), adobe),
+			withSegments(plain, jfif, icc, adobe)},
+		{"fill bytes", withSegments(plain, []byte{0xff, 0xff}, exif), plain},
+		{"trailing picture", append(withSegments(plain, exif), trailer...), plain},
+		{"trailing junk", append(append([]byte{}, plain...), "Exif GPS"...), plain},
+		{"comment after the scan", append(plain[:len(plain)-2:len(plain)-2], append(jpegSegment(0xfe, "late"), 0xff, 0xd9)...), plain},
+		{"no end of image", withSegments(plain[:len(plain)-2], exif), plain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripJPEG(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %d bytes, want %d", len(got), len(tt.want))
+			}
+			if bytes.Contains(got, []byte("Exif")) || bytes.Contains(got, []byte("GPS")) {
+				t.Error("EXIF data left in the image")
+			}
+			if _, err = jpeg.Decode(bytes.NewReader(got)); err != nil {
+				t.Errorf("stripped image does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripJPEGMalformed(t *testing.T) {
+	plain := testJPEG(t)
+
+	for name, data := range map[string][]byte{
+		"empty":            nil,
+		"not a JPEG":       []byte("GIF89a"),
+		"segment too long": append([]byte{0xff, 0xd8}, 0xff, 0xe1, 0xff, 0xff, 'E'),
+		"bad length":       append([]byte{0xff, 0xd8}, 0xff, 0xe1, 0x00, 0x01),
+		"no marker":        append([]byte{0xff, 0xd8}, plain[2:3]...),
+		"cut before scan":  plain[:20],
+	} {
+		if _, err := stripJPEG(data); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+// pngChunk builds a PNG chunk with its CRC.
+func pngChunk(kind, data string) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, kind+data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE([]byte(kind+data)))
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	plain := buf.Bytes()
+
+	// The IHDR chunk follows the signature and is 25 bytes long.
+	head, tail := plain[:33], plain[33:]
+	gama := pngChunk("gAMA", "\x00\x00\xb1\x8f")
+
+	var in []byte
+	in = append(in, head...)
+	in = append(in, pngChunk("tEXt", "Author\x00someone")...)
+	in = append(in, gama...)
+	in = append(in, pngChunk("eXIf", "MM\x00*GPS")...)
+	in = append(in, pngChunk("iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>")...)
+	in = append(in, tail...)
+	in = append(in, "trailing GPS"...)
+
+	got, err := stripPNG(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := append(append(append([]byte{}, head...), gama...), tail...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+	if _, err = png.Decode(bytes.NewReader(got)); err != nil {
+		t.Errorf("stripped image does not decode: %v", err)
+	}
+
+	if _, err = stripPNG(plain[:40]); err == nil {
+		t.Error("no error for a cut short PNG")
+	}
+	if _, err = stripPNG([]byte("GIF89a")); err == nil {
+		t.Error("no error for a GIF")
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := testJPEG(t)
+
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"none", plain, 0},
+		{"little endian", withSegments(plain, jpegSegment(0xe1, "Exif\x00\x00"+string(exifTIFF(binary.LittleEndian, 6)))), 6},
+		{"big endian", withSegments(plain, jpegSegment(0xe1, "Exif\x00\x00"+string(exifTIFF(binary.BigEndian, 8)))), 8},
+		{"after other segments", withSegments(plain, jpegSegment(0xe0, "JFIF\x00"),
+			jpegSegment(0xe1, "Exif\x00\x00"+string(exifTIFF(binary.BigEndian, 3)))), 3},
+		{"XMP only", withSegments(plain, jpegSegment(0xe1, "http://ns.adobe.com/xap/1.0/\x00")), 0},
+		{"bad byte order", withSegments(plain, jpegSegment(0xe1, "Exif\x00\x00XX\x00*\x00\x00\x00\x08")), 0},
+		{"IFD out of range", withSegments(plain, jpegSegment(0xe1, "Exif\x00\x00II*\x00\xff\x00\x00\x00")), 0},
+		{"cut short IFD", withSegments(plain, jpegSegment(0xe1, "Exif\x00\x00"+string(exifTIFF(binary.LittleEndian, 6)[:14]))), 0},
+		{"not a JPEG", []byte("GIF89a"), 0},
+	}
+
+	for _, tt := range tests {
+		if got := jpegOrientation(tt.data); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// The image as stored is
+	//
+	//	A B C
+	//	D E F
+	//
+	// and each orientation says how to turn it to show it the right way up.
+	src := image.NewGray(image.Rect(10, 20, 13, 22))
+	for i, c := range "ABCDEF" {
+		src.SetGray(10+i%3, 20+i/3, color.Gray{uint8(c)})
+	}
+
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{1, []string{"ABC", "DEF"}},
+		{2, []string{"CBA", "FED"}},
+		{3, []string{"FED", "CBA"}},
+		{4, []string{"DEF", "ABC"}},
+		{5, []string{"AD", "BE", "CF"}},
+		{6, []string{"DA", "EB", "FC"}},
+		{7, []string{"FC", "EB", "DA"}},
+		{8, []string{"CF", "BE", "AD"}},
+	}
+
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+
+		var got []string
+		for y := range dst.Bounds().Dy() {
+			var row []byte
+			for x := range dst.Bounds().Dx() {
+				row = append(row, color.GrayModel.Convert(dst.At(x, y)).(color.Gray).Y)
+			}
+			got = append(got, string(row))
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("orientation %d: got %q, want %q", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+// testGIF encodes an animation of frames frames of the given size on a
+// canvas of width by height. With local set every frame has its own colour
+// table.
+func testGIF(t *testing.T, frames, width, height, size int, local bool) []byte {
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{Width: width, Height: height, ColorModel: palette}}
+	for i := range frames {
+		frame := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+		frame.SetColorIndex(0, 0, uint8(i%2))
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	if local {
+		g.Config.ColorModel = nil
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGIFFrames(t *testing.T) {
+	five := testGIF(t, 5, 8, 8, 8, false)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		limit int
+		want  int
+	}{
+		{"global colour table", five, 100, 5},
+		{"local colour tables", testGIF(t, 7, 8, 8, 8, true), 100, 7},
+		{"single frame", testGIF(t, 1, 8, 8, 8, false), 100, 1},
+		{"stops past the limit", testGIF(t, 50, 8, 8, 1, false), 3, 4},
+		{"cut short", five[:len(five)/2], 100, 2},
+		{"not a GIF", []byte("\x89PNG\r\n\x1a\n0000000000"), 100, 0},
+		{"header only", five[:13], 100, 0},
+	}
+
+	for _, tt := range tests {
+		got := gifFrames(tt.data, tt.limit)
+		if tt.name == "cut short" {
+			// Only the complete frames before the cut are counted.
+			if got < 1 || got >= 5 {
+				t.Errorf("%s: got %d frames", tt.name, got)
+			}
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %d frames, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// documents renders Markdown files with GitHub's extensions. Table cells are
+// aligned with the align attribute, the style attribute would be refused by
+// the Content-Security-Policy.
+var documents = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.Linkify,
+		extension.TaskList,
+	),
+	goldmark.WithRendererOptions(highlighting),
+)
+
+// Heading is an entry in the table of contents of a document.
+type Heading struct {
+	Level int
+	Text  string
+	ID    string
+}
+
+// Document renders a Markdown file. Headings get ids starting with idPrefix,
+// which keeps them apart from the other anchors on the page, and a link to
+// themselves. They are returned in order for a table of contents.
+func Document(src, idPrefix string) (template.HTML, []Heading) {
+	source := []byte(src)
+	doc := documents.Parser().Parse(text.NewReader(source))
+
+	var headings []Heading
+	seen := map[string]int{}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+
+		title := plainText(heading, source)
+		slug := slugify(title)
+		if slug == "" {
+			slug = "section"
+		}
+		if count := seen[slug]; count > 0 {
+			seen[slug]++
+			slug += "-" + strconv.Itoa(count)
+		} else {
+			seen[slug] = 1
+		}
+		id := idPrefix + slug
+
+		heading.SetAttributeString("id", []byte(id))
+		anchor := ast.NewLink()
+		anchor.Destination = []byte("#" + id)
+		anchor.SetAttributeString("class", []byte("anchor"))
+		anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+		heading.AppendChild(heading, anchor)
+
+		headings = append(headings, Heading{Level: heading.Level, Text: title, ID: id})
+		return ast.WalkSkipChildren, nil
+	})
+
+	var buf bytes.Buffer
+	if err := documents.Renderer().Render(&buf, source, doc); err != nil {
+		return template.HTML("<pre>" + template.HTMLEscapeString(src) + "</pre>"), nil
+	}
+
+	return template.HTML(Sanitize(buf.String())), headings
+}
+
+// plainText returns the text of a heading without its markup.
+func plainText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// slugify makes an anchor out of heading text the way GitHub does: lower
+// case, spaces turned into dashes and punctuation dropped.
+func slugify(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
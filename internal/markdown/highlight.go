@@ -0,0 +1,45 @@
+package markdown
+
+import (
+	"snippetbox/internal/highlight"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// codeBlockRenderer renders fenced code blocks with the same colours as code
+// on the view pages.
+type codeBlockRenderer struct{}
+
+func (codeBlockRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, renderFencedCodeBlock)
+}
+
+func renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	n := node.(*ast.FencedCodeBlock)
+	language := string(n.Language(source))
+
+	var code []byte
+	for i := 0; i < n.Lines().Len(); i++ {
+		line := n.Lines().At(i)
+		code = append(code, line.Value(source)...)
+	}
+
+	_, _ = w.WriteString("<pre><code")
+	if language != "" {
+		_, _ = w.WriteString(` class="language-` + string(util.EscapeHTML([]byte(language))) + `"`)
+	}
+	_ = w.WriteByte('>')
+	_, _ = w.WriteString(string(highlight.HTML(language, string(code))))
+	_, _ = w.WriteString("</code></pre>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+// highlighting registers codeBlockRenderer ahead of the default renderer.
+var highlighting = renderer.WithNodeRenderers(util.Prioritized(codeBlockRenderer{}, 100))
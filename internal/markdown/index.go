@@ -0,0 +1,30 @@
+// Package markdown turns Markdown written by users into HTML that is safe to
+// show on the site.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	gmhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// comments renders comment bodies. Line breaks are kept since people type
+// comments like chat messages rather than documents.
+var comments = goldmark.New(
+	goldmark.WithExtensions(extension.Strikethrough, extension.Linkify),
+	goldmark.WithRendererOptions(gmhtml.WithHardWraps(), highlighting),
+)
+
+// Comment renders the Markdown of a comment. Raw HTML in the source is not
+// passed through, and the output is sanitized all the same.
+func Comment(src string) template.HTML {
+	var buf bytes.Buffer
+	if err := comments.Convert([]byte(src), &buf); err != nil {
+		return template.HTML("<p>" + template.HTMLEscapeString(src) + "</p>")
+	}
+
+	return template.HTML(Sanitize(buf.String()))
+}
@@ -0,0 +1,220 @@
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// allowedElements lists the elements kept by Sanitize and their allowed
+// attributes. Everything else is removed, leaving its text behind.
+var allowedElements = map[string][]string{
+	"a":          {"href", "title", "class"},
+	"blockquote": {},
+	"br":         {},
+	"code":       {"class"},
+	"del":        {},
+	"em":         {},
+	"h1":         {"id"},
+	"h2":         {"id"},
+	"h3":         {"id"},
+	"h4":         {"id"},
+	"h5":         {"id"},
+	"h6":         {"id"},
+	"hr":         {},
+	"img":        {"src", "alt", "title"},
+	"input":      {"type", "checked"},
+	"li":         {},
+	"ol":         {"start"},
+	"p":          {},
+	"pre":        {},
+	"span":       {"class"},
+	"strong":     {},
+	"table":      {},
+	"tbody":      {},
+	"td":         {"align"},
+	"th":         {"align"},
+	"thead":      {},
+	"tr":         {},
+	"ul":         {},
+}
+
+// droppedElements are removed along with everything in them.
+var droppedElements = map[string]bool{
+	"iframe":   true,
+	"noscript": true,
+	"object":   true,
+	"script":   true,
+	"style":    true,
+	"template": true,
+	"textarea": true,
+	"title":    true,
+}
+
+var voidElements = map[string]bool{"br": true, "hr": true, "img": true, "input": true}
+
+var (
+	languageClassRX = regexp.MustCompile(`^language-[a-z0-9+#_-]+$`)
+	numberRX        = regexp.MustCompile(`^[0-9]{1,9}$`)
+	highlightRX     = regexp.MustCompile(`^hl-[a-z]+$`)
+	idRX            = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N}._-]*$`)
+	alignRX         = regexp.MustCompile(`^(left|center|right)$`)
+)
+
+// linkSchemes are the URL schemes links may use. Relative links have none.
+var linkSchemes = []string{"", "http", "https", "mailto"}
+
+// Sanitize keeps the allowlisted elements and attributes of an HTML fragment
+// and drops the rest. What's left fits the Content-Security-Policy of the
+// site: no scripts, event handlers or inline styles, and images only from
+// the site itself since browsers would refuse to load any others. Those are
+// replaced by their alt text.
+func Sanitize(fragment string) string {
+	z := html.NewTokenizer(strings.NewReader(fragment))
+	var b strings.Builder
+	var open []string
+	dropping := 0
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				b.WriteString("</" + open[i] + ">")
+			}
+			return b.String()
+
+		case html.TextToken:
+			if dropping == 0 {
+				b.WriteString(html.EscapeString(string(z.Text())))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if droppedElements[t.Data] {
+				if tt == html.StartTagToken {
+					dropping++
+				}
+				continue
+			}
+			if dropping > 0 {
+				continue
+			}
+			if !writeStartTag(&b, t) {
+				continue
+			}
+			if !voidElements[t.Data] {
+				open = append(open, t.Data)
+			}
+
+		case html.EndTagToken:
+			t := z.Token()
+			if droppedElements[t.Data] {
+				dropping = max(dropping-1, 0)
+				continue
+			}
+			if dropping > 0 {
+				continue
+			}
+			// Close whatever was left open inside the element as well, so
+			// the output is always balanced.
+			if i := slices.Index(open, t.Data); i >= 0 {
+				for j := len(open) - 1; j >= i; j-- {
+					b.WriteString("</" + open[j] + ">")
+				}
+				open = open[:i]
+			}
+		}
+	}
+}
+
+// writeStartTag writes the tag with its allowed attributes and reports
+// whether it was kept.
+func writeStartTag(b *strings.Builder, t html.Token) bool {
+	allowed, ok := allowedElements[t.Data]
+	if !ok {
+		return false
+	}
+
+	attrs := map[string]string{}
+	for _, a := range t.Attr {
+		if a.Namespace == "" && slices.Contains(allowed, a.Key) {
+			attrs[a.Key] = a.Val
+		}
+	}
+
+	switch t.Data {
+	case "a":
+		if href, ok := attrs["href"]; ok && !safeLink(href) {
+			delete(attrs, "href")
+		}
+		if attrs["class"] != "anchor" {
+			delete(attrs, "class")
+		}
+		attrs["rel"] = "nofollow ugc noopener"
+	case "img":
+		if !localURL(attrs["src"]) {
+			b.WriteString(html.EscapeString(attrs["alt"]))
+			return false
+		}
+	case "code":
+		if !languageClassRX.MatchString(attrs["class"]) {
+			delete(attrs, "class")
+		}
+	case "span":
+		if !highlightRX.MatchString(attrs["class"]) {
+			return false
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if !idRX.MatchString(attrs["id"]) {
+			delete(attrs, "id")
+		}
+	case "td", "th":
+		if !alignRX.MatchString(attrs["align"]) {
+			delete(attrs, "align")
+		}
+	case "input":
+		// Only the disabled checkboxes of task lists.
+		if attrs["type"] != "checkbox" {
+			return false
+		}
+		if _, ok := attrs["checked"]; ok {
+			attrs["checked"] = ""
+		}
+		attrs["disabled"] = ""
+	case "ol":
+		if !numberRX.MatchString(attrs["start"]) {
+			delete(attrs, "start")
+		}
+	}
+
+	b.WriteString("<" + t.Data)
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		b.WriteString(" " + k + `="` + html.EscapeString(attrs[k]) + `"`)
+	}
+	b.WriteString(">")
+
+	return true
+}
+
+// safeLink reports whether a link target is harmless to follow.
+func safeLink(href string) bool {
+	u, err := url.Parse(href)
+	return err == nil && slices.Contains(linkSchemes, strings.ToLower(u.Scheme))
+}
+
+// localURL reports whether a URL points at this site, the only place the
+// Content-Security-Policy lets images come from.
+func localURL(src string) bool {
+	u, err := url.Parse(src)
+	return err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/") &&
+		!strings.HasPrefix(src, "//") && !strings.Contains(src, `\`)
+}
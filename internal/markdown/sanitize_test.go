@@ -0,0 +1,193 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"text", `a < b & "c"`, `a &lt; b &amp; &#34;c&#34;`},
+		{"allowed markup", `<p><strong>bold</strong> <em>it</em> <del>old</del></p>`, `<p><strong>bold</strong> <em>it</em> <del>old</del></p>`},
+		{"link", `<a href="https://example.com/" title="t">x</a>`, `<a href="https://example.com/" rel="nofollow ugc noopener" title="t">x</a>`},
+		{"relative link", `<a href="/snippet/view/1">x</a>`, `<a href="/snippet/view/1" rel="nofollow ugc noopener">x</a>`},
+		{"mailto link", `<a href="mailto:a@example.com">x</a>`, `<a href="mailto:a@example.com" rel="nofollow ugc noopener">x</a>`},
+		{"anchor class", `<a href="#h" class="anchor">#</a><a href="#h" class="evil">#</a>`,
+			`<a class="anchor" href="#h" rel="nofollow ugc noopener">#</a><a href="#h" rel="nofollow ugc noopener">#</a>`},
+		{"local image", `<img src="/static/img/logo.png" alt="logo">`, `<img alt="logo" src="/static/img/logo.png">`},
+		{"remote image", `<img src="https://example.com/x.png" alt="remote <x>">`, `remote &lt;x&gt;`},
+		{"protocol relative image", `<img src="//example.com/x.png" alt="x">`, `x`},
+		{"backslash image", `<img src="/\example.com/x.png" alt="x">`, `x`},
+		{"code language", `<pre><code class="language-go">x</code></pre>`, `<pre><code class="language-go">x</code></pre>`},
+		{"code class", `<code class="language-go x">x</code>`, `<code>x</code>`},
+		{"highlight span", `<span class="hl-keyword">func</span><span class="other">x</span>`, `<span class="hl-keyword">func</span>x`},
+		{"heading id", `<h2 id="readme-usage">Usage</h2><h3 id="&quot;x">Y</h3>`, `<h2 id="readme-usage">Usage</h2><h3>Y</h3>`},
+		{"table align", `<table><tr><td align="center">a</td><td align="justify">b</td></tr></table>`,
+			`<table><tr><td align="center">a</td><td>b</td></tr></table>`},
+		{"task list", `<input type="checkbox" checked="">`, `<input checked="" disabled="" type="checkbox">`},
+		{"other input", `<input type="text" value="x">`, ``},
+		{"list start", `<ol start="3"><li>c</li></ol><ol start="-1"></ol>`, `<ol start="3"><li>c</li></ol><ol></ol>`},
+		{"unclosed elements", `<p><strong>x`, `<p><strong>x</strong></p>`},
+		{"misnested elements", `<p><em>x</p>y</em>`, `<p><em>x</em></p>y`},
+		{"stray end tag", `</p>x</div>`, `x`},
+		{"comment", `a<!-- <script>alert(1)</script> -->b`, `ab`},
+	}
+
+	for _, tt := range tests {
+		if got := Sanitize(tt.in); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// xssVectors must come out without anything a browser would run.
+var xssVectors = []string{
+	`<script>alert(1)</script>`,
+	`<SCRIPT SRC=//evil.example/x.js></SCRIPT>`,
+	`<script>alert(1)`,
+	`<script><script></script>alert(1)</script><img src=x onerror=alert(1)>`,
+	`<scr<script>ipt>alert(1)</script>`,
+	`<style>*{background:url(javascript:alert(1))}</style>`,
+	`<style>@import "//evil.example/x.css";`,
+	`<p style="background:url(javascript:alert(1))">x</p>`,
+	`<svg onload=alert(1)>`,
+	`<svg><script>alert(1)</script></svg>`,
+	`<svg><a xlink:href="javascript:alert(1)"><text>x</text></a></svg>`,
+	`<math><mtext><table><mglyph><style><img src=x onerror=alert(1)>`,
+	`<img src=x onerror=alert(1)>`,
+	`<img src="/ok.png" onerror="alert(1)">`,
+	`<img src="/ok.png" srcset="https://evil.example/x.png 1x, javascript:alert(1) 2x">`,
+	`<img src="javascript:alert(1)">`,
+	`<a href="javascript:alert(1)">x</a>`,
+	`<a href="JaVaScRiPt:alert(1)">x</a>`,
+	`<a href=" javascript:alert(1)">x</a>`,
+	`<a href="&#x20;javascript:alert(1)">x</a>`,
+	`<a href="&#1;javascript:alert(1)">x</a>`,
+	`<a href="java&#x09;script:alert(1)">x</a>`,
+	`<a href="java&#x0A;script:alert(1)">x</a>`,
+	`<a href="javascript&#58;alert(1)">x</a>`,
+	`<a href="javascript&colon;alert(1)">x</a>`,
+	`<a href="&#106;&#97;&#118;&#97;&#115;&#99;&#114;&#105;&#112;&#116;&#58;alert(1)">x</a>`,
+	`<a href="&#x6A;avascript:alert(1)">x</a>`,
+	`<a href="vbscript:msgbox(1)">x</a>`,
+	`<a href="data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==">x</a>`,
+	`<a href="https://example.com/" onclick="alert(1)" target="_blank">x</a>`,
+	`<a href="/x" onmouseover=alert(1)>x</a>`,
+	`<a/href="javascript:alert(1)">x</a>`,
+	`<p onclick="alert(1)">x</p>`,
+	`<h1 id="x" onfocus="alert(1)" autofocus tabindex="0">x</h1>`,
+	`<code class="language-go" onclick="alert(1)">x</code>`,
+	`<span class="hl-keyword" style="color:red" onclick="alert(1)">x</span>`,
+	`<input type="checkbox" onfocus="alert(1)" autofocus>`,
+	`<iframe src="javascript:alert(1)"></iframe>`,
+	`<iframe srcdoc="<script>alert(1)</script>">`,
+	`<object data="javascript:alert(1)"></object>`,
+	`<embed src="javascript:alert(1)">`,
+	`<form action="javascript:alert(1)"><button>x</button></form>`,
+	`<base href="javascript:alert(1)//">`,
+	`<meta http-equiv="refresh" content="0;url=javascript:alert(1)">`,
+	`<link rel="stylesheet" href="//evil.example/x.css">`,
+	`<template><script>alert(1)</script></template>`,
+	`<noscript><p title="</noscript><img src=x onerror=alert(1)>">`,
+	`<textarea></textarea><script>alert(1)</script>`,
+	`<title><script>alert(1)</script></title>`,
+	`<xmp><script>alert(1)</script></xmp>`,
+	`<noembed><script>alert(1)</script></noembed>`,
+	`<plaintext><script>alert(1)</script>`,
+	`<!--><script>alert(1)</script>-->`,
+	`<![CDATA[<script>alert(1)</script>]]>`,
+	`<p title="x&quot; onmouseover=&quot;alert(1)">x</p>`,
+	`<a title="&quot;><script>alert(1)</script>" href="/x">x</a>`,
+	`<img src="/ok.png" alt="&quot; onerror=&quot;alert(1)">`,
+	`<img src="https://evil.example/x.png" alt="<script>alert(1)</script>">`,
+	`<details open ontoggle=alert(1)>`,
+	`<video><source onerror="alert(1)"></video>`,
+	`<body onload=alert(1)>`,
+	`<div style="behavior:url(x.htc)">`,
+	`<a href="x" style="position:fixed;top:0">x</a>`,
+}
+
+// elements that would run or load something if they made it through.
+var dangerousElements = map[string]bool{
+	"script": true, "style": true, "svg": true, "math": true, "iframe": true, "object": true, "embed": true,
+	"form": true, "base": true, "meta": true, "link": true, "template": true, "video": true, "source": true,
+}
+
+func TestSanitizeXSS(t *testing.T) {
+	for _, vector := range xssVectors {
+		out := Sanitize(vector)
+
+		// Parse the output the way a browser would and look at every
+		// element and attribute that made it through.
+		doc, err := html.Parse(strings.NewReader(out))
+		if err != nil {
+			t.Errorf("%s: output does not parse: %v", vector, err)
+			continue
+		}
+
+		var check func(n *html.Node)
+		check = func(n *html.Node) {
+			if n.Type == html.ElementNode {
+				if dangerousElements[n.Data] {
+					t.Errorf("%s:\n%s\nkeeps a %s element", vector, out, n.Data)
+				}
+				for _, a := range n.Attr {
+					key := strings.ToLower(a.Key)
+					if strings.HasPrefix(key, "on") || key == "style" || key == "srcset" || key == "srcdoc" || key == "target" {
+						t.Errorf("%s:\n%s\nkeeps the %s attribute", vector, out, a.Key)
+					}
+					if (key == "href" || key == "src" || key == "action") && !harmlessURL(a.Val) {
+						t.Errorf("%s:\n%s\nkeeps %s=%q", vector, out, a.Key, a.Val)
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				check(c)
+			}
+		}
+		check(doc)
+	}
+}
+
+// harmlessURL reports whether a browser would treat u as a relative, http,
+// https or mailto URL, stripping what browsers strip before the scheme.
+func harmlessURL(u string) bool {
+	u = strings.TrimLeft(u, "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f"+
+		"\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f ")
+	u = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(u)
+	scheme, _, found := strings.Cut(u, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return true
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+func TestComment(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"**bold**", "<p><strong>bold</strong></p>\n"},
+		{"line one\nline two", "<p>line one<br>\nline two</p>\n"},
+		{"<script>alert(1)</script>", "\n"},
+		{"[x](javascript:alert(1))", `<p><a href="" rel="nofollow ugc noopener">x</a></p>` + "\n"},
+		{"![x](https://evil.example/x.png)", "<p>x</p>\n"},
+		{"https://example.com", `<p><a href="https://example.com" rel="nofollow ugc noopener">https://example.com</a></p>` + "\n"},
+	}
+
+	for _, tt := range tests {
+		if got := string(Comment(tt.in)); got != tt.want {
+			t.Errorf("Comment(%q):\ngot  %q\nwant %q", tt.in, got, tt.want)
+		}
+	}
+}
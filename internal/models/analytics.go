@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"snippetbox/internal/analytics"
+	"snippetbox/internal/hyperloglog"
+)
+
+// DayStats are the views of a snippet on one day. Visitors estimates the
+// unique visitors of that day alone; days can't be added up into unique
+// visitors, see analytics.Counts.
+type DayStats struct {
+	Day      time.Time
+	Views    int
+	Visitors uint64
+}
+
+// RecordViews saves a batch of view counts in one transaction: the hourly
+// counts trending scores are computed from, the totals on the snippets and
+// the daily views and visitors of the stats page. Views of snippets deleted
+// in the meantime are dropped.
+func (m *SnippetModel) RecordViews(ctx context.Context, batch []analytics.Counts) error {
+	// A fixed order keeps concurrent batches from deadlocking on each other.
+	slices.SortFunc(batch, func(a, b analytics.Counts) int {
+		if a.SnippetID != b.SnippetID {
+			return a.SnippetID - b.SnippetID
+		}
+		return a.Hour.Compare(b.Hour)
+	})
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, c := range batch {
+		// Hours are placed by their age, so the database clock and time zone
+		// decide which hour and day they fall in, as they do for NOW()
+		// elsewhere. Measuring from the middle of the hour leaves room for
+		// the clocks to differ.
+		age := time.Since(c.Hour.Add(30 * time.Minute)).Seconds()
+
+		stmt := `INSERT INTO snippet_views (snippet_id, hour, views)
+					SELECT id, DATE_TRUNC('hour', NOW() - $2 * INTERVAL '1 second'), $3 FROM snippets WHERE id = $1
+					ON CONFLICT (snippet_id, hour) DO UPDATE SET views = snippet_views.views + EXCLUDED.views`
+
+		result, err := tx.ExecContext(ctx, stmt, c.SnippetID, age, c.Views)
+		if err != nil {
+			return err
+		}
+		if err = expectRow(result); errors.Is(err, ErrNoRecord) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, `UPDATE snippets SET views = views + $2 WHERE id = $1`, c.SnippetID, c.Views); err != nil {
+			return err
+		}
+
+		if err = recordDay(ctx, tx, c, age); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// recordDay adds counts to the stats of their day, merging the visitors into
+// the sketch of the day.
+func recordDay(ctx context.Context, tx *sql.Tx, c analytics.Counts, age float64) error {
+	stmt := `INSERT INTO snippet_daily_stats (snippet_id, day) VALUES ($1, (NOW() - $2 * INTERVAL '1 second')::DATE)
+				ON CONFLICT DO NOTHING`
+
+	if _, err := tx.ExecContext(ctx, stmt, c.SnippetID, age); err != nil {
+		return err
+	}
+
+	var raw []byte
+	stmt = `SELECT visitors FROM snippet_daily_stats WHERE snippet_id = $1
+				AND day = (NOW() - $2 * INTERVAL '1 second')::DATE FOR UPDATE`
+
+	if err := tx.QueryRowContext(ctx, stmt, c.SnippetID, age).Scan(&raw); err != nil {
+		return err
+	}
+
+	visitors := hyperloglog.New()
+	if raw != nil {
+		day, err := hyperloglog.FromBytes(raw)
+		if err != nil {
+			return err
+		}
+		visitors = day
+	}
+	visitors.Merge(c.Visitors)
+
+	stmt = `UPDATE snippet_daily_stats SET views = views + $3, visitors = $4
+				WHERE snippet_id = $1 AND day = (NOW() - $2 * INTERVAL '1 second')::DATE`
+
+	_, err := tx.ExecContext(ctx, stmt, c.SnippetID, age, c.Views, visitors.Bytes())
+	return err
+}
+
+// ViewStats returns the views and visitors of a snippet on each of the last
+// days, today included. Days without views are included with zero counts.
+func (m *SnippetModel) ViewStats(snippetID, days int) ([]DayStats, error) {
+	stmt := `SELECT days.day, COALESCE(stats.views, 0), stats.visitors
+				FROM GENERATE_SERIES(CURRENT_DATE - ($2 - 1) * INTERVAL '1 day', CURRENT_DATE, INTERVAL '1 day') AS days (day)
+				LEFT JOIN snippet_daily_stats AS stats ON stats.snippet_id = $1 AND stats.day = days.day
+				ORDER BY days.day`
+
+	rows, err := m.DB.Query(stmt, snippetID, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []DayStats{}
+
+	for rows.Next() {
+		d := DayStats{}
+		var raw []byte
+		if err = rows.Scan(&d.Day, &d.Views, &raw); err != nil {
+			return nil, err
+		}
+		// Days without views have no sketch.
+		if visitors, err := hyperloglog.FromBytes(raw); err == nil {
+			d.Visitors = visitors.Estimate()
+		}
+		stats = append(stats, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Attachment struct {
+	ID          int
+	SnippetID   int
+	UserID      int
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string
+	StorageKey  string
+	Created     time.Time
+
+	// Images also have their dimensions and a thumbnail.
+	Width    int
+	Height   int
+	ThumbKey string
+}
+
+// IsImage reports whether the attachment is an image shown inline.
+func (a Attachment) IsImage() bool {
+	return a.ThumbKey != ""
+}
+
+// BlobKeys returns the keys of every blob stored for the attachment.
+func (a Attachment) BlobKeys() []string {
+	if a.ThumbKey == "" {
+		return []string{a.StorageKey}
+	}
+	return []string{a.StorageKey, a.ThumbKey}
+}
+
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+func NewAttachmentModel(db *sql.DB) *AttachmentModel {
+	return &AttachmentModel{DB: db}
+}
+
+const attachmentColumns = `id, snippet_id, COALESCE(user_id, 0), filename, content_type, size, sha256, storage_key, created,
+	width, height, COALESCE(thumb_key, '')`
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	a := Attachment{}
+	err := row.Scan(&a.ID, &a.SnippetID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.StorageKey, &a.Created,
+		&a.Width, &a.Height, &a.ThumbKey)
+	return a, err
+}
+
+func scanAttachments(rows *sql.Rows) ([]Attachment, error) {
+	defer rows.Close()
+
+	attachments := []Attachment{}
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func (m *AttachmentModel) Insert(a Attachment) (int, error) {
+	stmt := `INSERT INTO attachments (snippet_id, user_id, filename, content_type, size, sha256, storage_key, created,
+				width, height, thumb_key)
+				VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, NOW(), $8, $9, NULLIF($10, '')) RETURNING id`
+
+	var id int
+	err := m.DB.QueryRow(stmt, a.SnippetID, a.UserID, a.Filename, a.ContentType, a.Size, a.SHA256, a.StorageKey,
+		a.Width, a.Height, a.ThumbKey).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (m *AttachmentModel) Get(id, snippetID int) (Attachment, error) {
+	stmt := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1 AND snippet_id = $2`
+
+	a, err := scanAttachment(m.DB.QueryRow(stmt, id, snippetID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Attachment{}, ErrNoRecord
+		}
+		return Attachment{}, err
+	}
+
+	return a, nil
+}
+
+func (m *AttachmentModel) ForSnippet(snippetID int) ([]Attachment, error) {
+	stmt := `SELECT ` + attachmentColumns + ` FROM attachments WHERE snippet_id = $1 ORDER BY created, id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAttachments(rows)
+}
+
+// Thumbnails returns the first image of each of the given snippets that has
+// one, keyed by snippet id.
+func (m *AttachmentModel) Thumbnails(snippetIDs []int) (map[int]Attachment, error) {
+	stmt := `SELECT DISTINCT ON (snippet_id) ` + attachmentColumns + ` FROM attachments
+				WHERE snippet_id = ANY($1) AND thumb_key IS NOT NULL ORDER BY snippet_id, created, id`
+
+	rows, err := m.DB.Query(stmt, pq.Array(snippetIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails := map[int]Attachment{}
+	for _, a := range attachments {
+		thumbnails[a.SnippetID] = a
+	}
+
+	return thumbnails, nil
+}
+
+// Delete removes the attachment row. The caller removes its blobs.
+func (m *AttachmentModel) Delete(id, snippetID int) error {
+	result, err := m.DB.Exec(`DELETE FROM attachments WHERE id = $1 AND snippet_id = $2`, id, snippetID)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Collection is a named set of snippets a user keeps in an order of their
+// choosing. Its visibility works like a snippet's.
+type Collection struct {
+	ID          int
+	UserID      int
+	UserName    string
+	Name        string
+	Description string
+	Visibility  string
+	Created     time.Time
+	Updated     time.Time
+	// Snippets is how many snippets in the collection its owner can see.
+	Snippets int
+}
+
+// IsPublic reports whether the collection may show up on the snippets it
+// holds.
+func (c Collection) IsPublic() bool {
+	return c.Visibility == VisibilityPublic
+}
+
+// VisibleTo reports whether the user may view the collection. A userID of 0
+// is an anonymous visitor.
+func (c Collection) VisibleTo(userID int) bool {
+	return c.Visibility != VisibilityPrivate || c.UserID == userID
+}
+
+// MaxCollectionSnippets is the most snippets a collection can hold, which
+// keeps its page and archive a sensible size.
+const MaxCollectionSnippets = 200
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func NewCollectionModel(db *sql.DB) *CollectionModel {
+	return &CollectionModel{DB: db}
+}
+
+// collectionColumns counts only the snippets the owner can still see, the
+// same ones the collection page shows them.
+const collectionColumns = `collections.id, collections.user_id, users.name, collections.name,
+	collections.description, collections.visibility, collections.created, collections.updated,
+	(SELECT COUNT(*) FROM collection_snippets JOIN snippets ON snippets.id = collection_snippets.snippet_id
+		WHERE collection_snippets.collection_id = collections.id AND ` + collectedVisibleTo + `)`
+
+// collectedVisibleTo filters snippets in a collection down to those the
+// collection owner can see. Snippets someone else made private since they
+// were added are skipped rather than removed, so they come back if they are
+// made visible again.
+const collectedVisibleTo = `snippets.expires > NOW()
+	AND (snippets.visibility <> 'private' OR snippets.user_id = collections.user_id)`
+
+const collectionTables = `collections JOIN users ON users.id = collections.user_id`
+
+func scanCollection(row rowScanner) (Collection, error) {
+	c := Collection{}
+	err := row.Scan(&c.ID, &c.UserID, &c.UserName, &c.Name, &c.Description, &c.Visibility, &c.Created, &c.Updated, &c.Snippets)
+	return c, err
+}
+
+func scanCollections(rows *sql.Rows) ([]Collection, error) {
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+
+	return collections, rows.Err()
+}
+
+func (m *CollectionModel) Insert(userID int, name, description, visibility string) (int, error) {
+	stmt := `INSERT INTO collections (user_id, name, description, visibility) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	var id int
+	err := m.DB.QueryRow(stmt, userID, name, description, visibility).Scan(&id)
+	return id, err
+}
+
+// Get returns a collection whatever its visibility.
+func (m *CollectionModel) Get(id int) (Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM ` + collectionTables + ` WHERE collections.id = $1`
+
+	c, err := scanCollection(m.DB.QueryRow(stmt, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Collection{}, ErrNoRecord
+		}
+		return Collection{}, err
+	}
+
+	return c, nil
+}
+
+// ForUser returns every collection of a user by name.
+func (m *CollectionModel) ForUser(userID int) ([]Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM ` + collectionTables + `
+				WHERE collections.user_id = $1 ORDER BY LOWER(collections.name), collections.id`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCollections(rows)
+}
+
+// Containing returns the collections holding a snippet that viewerID may
+// see listed there: the public ones and their own.
+func (m *CollectionModel) Containing(snippetID, viewerID int) ([]Collection, error) {
+	stmt := `SELECT ` + collectionColumns + ` FROM ` + collectionTables + `
+				JOIN collection_snippets ON collection_snippets.collection_id = collections.id
+				WHERE collection_snippets.snippet_id = $1
+				AND (collections.visibility = 'public' OR collections.user_id = $2)
+				ORDER BY LOWER(collections.name), collections.id`
+
+	rows, err := m.DB.Query(stmt, snippetID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCollections(rows)
+}
+
+// Update changes the name, description and visibility of a collection owned
+// by userID.
+func (m *CollectionModel) Update(id, userID int, name, description, visibility string) error {
+	stmt := `UPDATE collections SET name = $3, description = $4, visibility = $5, updated = NOW()
+				WHERE id = $1 AND user_id = $2`
+
+	result, err := m.DB.Exec(stmt, id, userID, name, description, visibility)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
+
+// Delete removes a collection owned by userID. The snippets in it are left
+// alone.
+func (m *CollectionModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM collections WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
+
+// AddSnippet appends a snippet to the end of a collection owned by userID.
+// Adding a snippet that is already there keeps it where it is. A collection
+// that already holds MaxCollectionSnippets, counting those its owner can't
+// see at the moment, takes no more and gives ErrCollectionFull.
+func (m *CollectionModel) AddSnippet(id, userID, snippetID int) error {
+	return m.change(id, userID, func(tx *sql.Tx) error {
+		var n int
+		stmt := `SELECT COUNT(*) FROM collection_snippets WHERE collection_id = $1 AND snippet_id <> $2`
+		if err := tx.QueryRow(stmt, id, snippetID).Scan(&n); err != nil {
+			return err
+		}
+		if n >= MaxCollectionSnippets {
+			return ErrCollectionFull
+		}
+
+		stmt = `INSERT INTO collection_snippets (collection_id, snippet_id, position)
+					SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM collection_snippets WHERE collection_id = $1
+					ON CONFLICT DO NOTHING`
+
+		_, err := tx.Exec(stmt, id, snippetID)
+		return err
+	})
+}
+
+// RemoveSnippet takes a snippet out of a collection owned by userID.
+func (m *CollectionModel) RemoveSnippet(id, userID, snippetID int) error {
+	return m.change(id, userID, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`DELETE FROM collection_snippets WHERE collection_id = $1 AND snippet_id = $2`, id, snippetID)
+		if err != nil {
+			return err
+		}
+		return expectRow(result)
+	})
+}
+
+// MoveSnippet swaps a snippet with the one before it in a collection owned
+// by userID, or with the one after it when up is false. Snippets the owner
+// can't see are stepped over, so every move changes what the page shows.
+// Moving the first snippet up or the last one down changes nothing.
+func (m *CollectionModel) MoveSnippet(id, userID, snippetID int, up bool) error {
+	return m.change(id, userID, func(tx *sql.Tx) error {
+		var position int
+		stmt := `SELECT position FROM collection_snippets WHERE collection_id = $1 AND snippet_id = $2`
+		err := tx.QueryRow(stmt, id, snippetID).Scan(&position)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNoRecord
+			}
+			return err
+		}
+
+		neighbour := `SELECT collection_snippets.snippet_id, collection_snippets.position
+					FROM collection_snippets
+					JOIN collections ON collections.id = collection_snippets.collection_id
+					JOIN snippets ON snippets.id = collection_snippets.snippet_id
+					WHERE collection_snippets.collection_id = $1 AND ` + collectedVisibleTo
+		if up {
+			neighbour += ` AND collection_snippets.position < $2 ORDER BY collection_snippets.position DESC LIMIT 1`
+		} else {
+			neighbour += ` AND collection_snippets.position > $2 ORDER BY collection_snippets.position LIMIT 1`
+		}
+
+		var otherID, otherPosition int
+		err = tx.QueryRow(neighbour, id, position).Scan(&otherID, &otherPosition)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		stmt = `UPDATE collection_snippets SET position = $3 WHERE collection_id = $1 AND snippet_id = $2`
+		if _, err = tx.Exec(stmt, id, snippetID, otherPosition); err != nil {
+			return err
+		}
+		_, err = tx.Exec(stmt, id, otherID, position)
+		return err
+	})
+}
+
+// change runs fn on the snippets of a collection owned by userID and marks
+// the collection updated. The collection row stays locked until the
+// transaction ends, so concurrent changes to the same collection take turns
+// and positions can't be handed out twice.
+func (m *CollectionModel) change(id, userID int, fn func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE collections SET updated = NOW() WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	if err = expectRow(result); err != nil {
+		return err
+	}
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Comment statuses. Only published comments are shown to everyone.
+const (
+	CommentPublished = "published"
+	CommentPending   = "pending"
+	CommentHidden    = "hidden"
+)
+
+// Comment is a comment in the discussion under a snippet. Body is Markdown.
+type Comment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	UserName  string
+	Body      string
+	Status    string
+	Created   time.Time
+	// Edited is zero for comments that were never changed.
+	Edited time.Time
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+func NewCommentModel(db *sql.DB) *CommentModel {
+	return &CommentModel{DB: db}
+}
+
+const commentColumns = `comments.id, comments.snippet_id, comments.user_id, users.name, comments.body, comments.status,
+	comments.created, comments.edited`
+
+func scanComment(row rowScanner) (Comment, error) {
+	c := Comment{}
+	var edited sql.NullTime
+	err := row.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.UserName, &c.Body, &c.Status, &c.Created, &edited)
+	c.Edited = edited.Time
+	return c, err
+}
+
+func (m *CommentModel) Insert(snippetID, userID int, body, status string) (int, error) {
+	stmt := `INSERT INTO comments (snippet_id, user_id, body, status) VALUES ($1, $2, $3, $4) RETURNING id`
+
+	var id int
+	err := m.DB.QueryRow(stmt, snippetID, userID, body, status).Scan(&id)
+	return id, err
+}
+
+// Get returns a comment on a snippet, whatever its status.
+func (m *CommentModel) Get(id, snippetID int) (Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments JOIN users ON users.id = comments.user_id
+				WHERE comments.id = $1 AND comments.snippet_id = $2`
+
+	c, err := scanComment(m.DB.QueryRow(stmt, id, snippetID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Comment{}, ErrNoRecord
+		}
+		return Comment{}, err
+	}
+
+	return c, nil
+}
+
+// ForSnippet returns the discussion under a snippet, oldest first, as seen
+// by viewerID: published comments, plus their own pending ones. The snippet
+// owner, who moderates, sees every comment.
+func (m *CommentModel) ForSnippet(snippetID, viewerID int, moderator bool) ([]Comment, error) {
+	stmt := `SELECT ` + commentColumns + ` FROM comments JOIN users ON users.id = comments.user_id
+				WHERE comments.snippet_id = $1
+				AND (comments.status = 'published' OR $3 OR (comments.status = 'pending' AND comments.user_id = $2))
+				ORDER BY comments.created, comments.id`
+
+	rows, err := m.DB.Query(stmt, snippetID, viewerID, moderator)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+
+	for rows.Next() {
+		c, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// Update replaces the body of a comment written by userID. Hidden comments
+// stay hidden, others take the status the edit was given.
+func (m *CommentModel) Update(id, snippetID, userID int, body, status string) error {
+	stmt := `UPDATE comments SET body = $1, edited = NOW(),
+				status = CASE WHEN status = 'hidden' THEN status ELSE $2 END
+				WHERE id = $3 AND snippet_id = $4 AND user_id = $5`
+
+	result, err := m.DB.Exec(stmt, body, status, id, snippetID, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
+
+// Delete removes a comment written by userID.
+func (m *CommentModel) Delete(id, snippetID, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM comments WHERE id = $1 AND snippet_id = $2 AND user_id = $3`, id, snippetID, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
+
+// SetStatus changes the status of a comment on a snippet, for moderation.
+func (m *CommentModel) SetStatus(id, snippetID int, status string) error {
+	result, err := m.DB.Exec(`UPDATE comments SET status = $1 WHERE id = $2 AND snippet_id = $3`, status, id, snippetID)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
@@ -0,0 +1,459 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DefaultBlobThreshold is the size in bytes above which snippet content is
+// moved out of Postgres when a blob store is configured.
+const DefaultBlobThreshold = 64 << 10
+
+// ContentHash returns the key content is stored under in snippet_contents.
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// acquireContent takes a reference on the shared copy of content and returns
+// its hash, storing the content first if nobody references it yet.
+//
+// Content above the threshold goes to the blob store under a key derived from
+// the hash. It is uploaded by whoever takes the first reference, while the
+// row is locked by the transaction, so the garbage collector, which deletes
+// the blob while holding the same lock, can never remove a blob that a
+// committed reference points at.
+func (m *SnippetModel) acquireContent(ctx context.Context, tx *sql.Tx, content string) (string, error) {
+	sum := ContentHash(content)
+
+	column, key := content, ""
+	if m.Blobs != nil && len(content) > m.BlobThreshold {
+		column, key = "", "contents/"+sum
+	}
+
+	stmt := `INSERT INTO snippet_contents (sha256, content, content_key, size, refs, created)
+				VALUES ($1, $2, NULLIF($3, ''), $4, 1, NOW())
+				ON CONFLICT (sha256) DO UPDATE SET refs = snippet_contents.refs + 1, released = NULL
+				RETURNING refs, COALESCE(content_key, '')`
+
+	var refs int
+	var storedKey string
+
+	err := tx.QueryRowContext(ctx, stmt, sum, column, key, len(content)).Scan(&refs, &storedKey)
+	if err != nil {
+		return "", err
+	}
+
+	// One reference means the row is new or was released and is being
+	// revived. Either way the blob may not exist, and writing it again is
+	// harmless as the key is derived from the content.
+	if refs == 1 && storedKey != "" {
+		if m.Blobs == nil {
+			return "", fmt.Errorf("models: content %s is in the blob store but none is configured", sum)
+		}
+		err = m.Blobs.Put(ctx, storedKey, strings.NewReader(content), "text/plain; charset=utf-8")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return sum, nil
+}
+
+// releaseContent drops a reference on shared content. Content nobody
+// references any more is left for CollectContents.
+func releaseContent(ctx context.Context, tx *sql.Tx, sum string) error {
+	if sum == "" {
+		return nil
+	}
+
+	stmt := `UPDATE snippet_contents SET refs = refs - 1,
+				released = CASE WHEN refs = 1 THEN NOW() ELSE released END
+				WHERE sha256 = $1`
+
+	_, err := tx.ExecContext(ctx, stmt, sum)
+	return err
+}
+
+// acquireFiles takes a reference on the content of every file and returns
+// their hashes in the same order.
+func (m *SnippetModel) acquireFiles(ctx context.Context, tx *sql.Tx, files []SnippetFile) ([]string, error) {
+	sums := make([]string, len(files))
+	for i, f := range files {
+		sum, err := m.acquireContent(ctx, tx, f.Content)
+		if err != nil {
+			return nil, err
+		}
+		sums[i] = sum
+	}
+
+	return sums, nil
+}
+
+// releaseFiles drops the references held by the extra files of a snippet
+// and, when revisions is set, by every file of its history. The rows
+// themselves are left for the caller to replace or delete.
+func releaseFiles(ctx context.Context, tx *sql.Tx, snippetID int, revisions bool) error {
+	held := `SELECT content_sha256 FROM snippet_files WHERE snippet_id = $1 AND content_sha256 IS NOT NULL`
+	if revisions {
+		held += ` UNION ALL SELECT snippet_revision_files.content_sha256 FROM snippet_revision_files
+					JOIN snippet_revisions ON snippet_revisions.id = snippet_revision_files.revision_id
+					WHERE snippet_revisions.snippet_id = $1`
+	}
+
+	stmt := `UPDATE snippet_contents SET refs = refs - held.n,
+				released = CASE WHEN refs = held.n THEN NOW() ELSE released END
+				FROM (SELECT content_sha256, COUNT(*) AS n FROM (` + held + `) AS files GROUP BY content_sha256) AS held
+				WHERE snippet_contents.sha256 = held.content_sha256`
+
+	_, err := tx.ExecContext(ctx, stmt, snippetID)
+	return err
+}
+
+// loadContent fills in the content of a snippet kept in the blob store.
+func (m *SnippetModel) loadContent(ctx context.Context, s *Snippet) error {
+	if s.ContentKey == "" {
+		return nil
+	}
+
+	content, err := m.readBlob(ctx, s.ContentKey)
+	if err != nil {
+		return fmt.Errorf("models: loading content of snippet %d: %w", s.ID, err)
+	}
+	s.Content = content
+
+	return nil
+}
+
+// readBlob returns content kept in the blob store under key.
+func (m *SnippetModel) readBlob(ctx context.Context, key string) (string, error) {
+	if m.Blobs == nil {
+		return "", fmt.Errorf("models: %s is in the blob store but none is configured", key)
+	}
+
+	blob, err := m.Blobs.Get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	content, err := io.ReadAll(blob)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// dropContent removes the blob of a snippet stored before content was
+// shared, which only that snippet referenced. Failing to do so only wastes
+// space, so errors are not returned.
+func (m *SnippetModel) dropContent(ctx context.Context, key string) {
+	if key != "" && m.Blobs != nil {
+		m.Blobs.Delete(ctx, key)
+	}
+}
+
+// Duplicates returns how many other unexpired snippets viewerID can see have
+// exactly the same content as the first file of s. Only public snippets and
+// the viewer's own are counted, so the figure can't be used to find out
+// whether some text exists in a snippet the viewer may not see. Empty content,
+// as in snippets made only of images, is not counted.
+func (m *SnippetModel) Duplicates(s Snippet, viewerID int) (int, error) {
+	if s.ContentSHA256 == "" || s.Content == "" {
+		return 0, nil
+	}
+
+	stmt := `SELECT COUNT(*) FROM snippets WHERE content_sha256 = $1 AND id <> $2 AND expires > NOW()
+				AND (visibility = 'public' OR user_id = $3)`
+
+	var n int
+	err := m.DB.QueryRow(stmt, s.ContentSHA256, s.ID, viewerID).Scan(&n)
+	return n, err
+}
+
+// CollectContents deletes up to limit contents nobody has referenced for at
+// least grace, along with their blobs. It returns how many were deleted.
+func (m *SnippetModel) CollectContents(ctx context.Context, grace time.Duration, limit int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The rows stay locked until the transaction ends, so a snippet created
+	// meanwhile with the same content waits and then stores it afresh.
+	stmt := `SELECT sha256, COALESCE(content_key, '') FROM snippet_contents
+				WHERE refs = 0 AND released < NOW() - $1 * INTERVAL '1 second'
+				ORDER BY released LIMIT $2 FOR UPDATE SKIP LOCKED`
+
+	rows, err := tx.QueryContext(ctx, stmt, int(grace.Seconds()), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type garbage struct{ sum, key string }
+	var found []garbage
+
+	for rows.Next() {
+		var g garbage
+		if err = rows.Scan(&g.sum, &g.key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		found = append(found, g)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+
+	for _, g := range found {
+		// Remove the blob first. If that fails the row stays and the next
+		// run tries again.
+		if g.key != "" && m.Blobs != nil {
+			if err = m.Blobs.Delete(ctx, g.key); err != nil {
+				continue
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM snippet_contents WHERE sha256 = $1`, g.sum)
+		if err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+
+	return deleted, tx.Commit()
+}
+
+// DeleteExpired deletes up to limit expired snippets, releasing the content
+// of their files and revisions and removing the blobs of their attachments. It returns how many snippets
+// were deleted.
+func (m *SnippetModel) DeleteExpired(ctx context.Context, limit int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM snippets WHERE expires <= NOW()
+				ORDER BY expires LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var blobs []string
+
+	for _, id := range ids {
+		rows, err := tx.QueryContext(ctx, `DELETE FROM attachments WHERE snippet_id = $1
+					RETURNING storage_key, COALESCE(thumb_key, '')`, id)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var key, thumbKey string
+			if err = rows.Scan(&key, &thumbKey); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			blobs = append(blobs, key, thumbKey)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return 0, err
+		}
+
+		if err = releaseFiles(ctx, tx, id, true); err != nil {
+			return 0, err
+		}
+
+		var key, sum string
+		err = tx.QueryRowContext(ctx, `DELETE FROM snippets WHERE id = $1
+					RETURNING COALESCE(content_key, ''), COALESCE(content_sha256, '')`, id).Scan(&key, &sum)
+		if err != nil {
+			return 0, err
+		}
+		if key != "" {
+			blobs = append(blobs, key)
+		}
+
+		if err = releaseContent(ctx, tx, sum); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	for _, key := range blobs {
+		m.dropContent(ctx, key)
+	}
+
+	return len(ids), nil
+}
+
+// ShareInlineFiles moves the content of up to limit extra files and up to
+// limit revisions that still keep their own copy of it into the shared
+// contents, where large content goes to the blob store like any other. Such
+// rows are left by servers that ran older code after the migration did. It
+// returns how many rows were moved, so callers repeat it until that is 0.
+func (m *SnippetModel) ShareInlineFiles(ctx context.Context, limit int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	type inline struct {
+		id  int
+		raw []byte
+	}
+
+	read := func(stmt string) ([]inline, error) {
+		rows, err := tx.QueryContext(ctx, stmt, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var found []inline
+		for rows.Next() {
+			var r inline
+			if err = rows.Scan(&r.id, &r.raw); err != nil {
+				return nil, err
+			}
+			found = append(found, r)
+		}
+		return found, rows.Err()
+	}
+
+	files, err := read(`SELECT id, content FROM snippet_files WHERE content_sha256 IS NULL
+				ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, f := range files {
+		sum, err := m.acquireContent(ctx, tx, string(f.raw))
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE snippet_files SET content = '', content_sha256 = $1 WHERE id = $2`, sum, f.id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	revisions, err := read(`SELECT id, files FROM snippet_revisions WHERE files IS NOT NULL
+				ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range revisions {
+		var revisionFiles []SnippetFile
+		if err = json.Unmarshal(r.raw, &revisionFiles); err != nil {
+			return 0, err
+		}
+
+		sums, err := m.acquireFiles(ctx, tx, revisionFiles)
+		if err != nil {
+			return 0, err
+		}
+
+		if err = insertRevisionFiles(ctx, tx, r.id, revisionFiles, sums); err != nil {
+			return 0, err
+		}
+
+		if _, err = tx.ExecContext(ctx, `UPDATE snippet_revisions SET files = NULL WHERE id = $1`, r.id); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(files) + len(revisions), nil
+}
+
+// MoveLargeContent moves up to limit stored contents that are larger than
+// the threshold but still kept in Postgres into the blob store. It returns how
+// many were moved, so callers repeat it until that is 0.
+func (m *SnippetModel) MoveLargeContent(ctx context.Context, limit int) (int, error) {
+	if m.Blobs == nil {
+		return 0, errors.New("models: no blob store configured")
+	}
+
+	stmt := `SELECT sha256, content FROM snippet_contents WHERE content_key IS NULL AND octet_length(content) > $1
+				ORDER BY sha256 LIMIT $2`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, m.BlobThreshold, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type pending struct{ sum, content string }
+	var contents []pending
+
+	for rows.Next() {
+		var p pending
+		if err = rows.Scan(&p.sum, &p.content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		contents = append(contents, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, p := range contents {
+		key := "contents/" + p.sum
+
+		err = m.Blobs.Put(ctx, key, strings.NewReader(p.content), "text/plain; charset=utf-8")
+		if err != nil {
+			return i, err
+		}
+
+		// Content never changes for a given hash, so the only thing that can
+		// happen meanwhile is the row being collected. The blob is then
+		// left behind, it may already belong to a new row for the same
+		// content.
+		stmt := `UPDATE snippet_contents SET content = '', content_key = $1 WHERE sha256 = $2 AND content_key IS NULL`
+
+		if _, err = m.DB.ExecContext(ctx, stmt, key, p.sum); err != nil {
+			return i, err
+		}
+	}
+
+	return len(contents), nil
+}
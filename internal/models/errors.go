@@ -1,7 +1,25 @@
 package models
 
 import (
+	"database/sql"
 	"errors"
 )
 
 var ErrNoRecord = errors.New("sql: no rows in result set")
+
+// ErrCollectionFull is returned when adding a snippet to a collection that
+// already holds MaxCollectionSnippets.
+var ErrCollectionFull = errors.New("models: collection is full")
+
+// expectRow turns an UPDATE or DELETE that matched nothing into ErrNoRecord.
+func expectRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
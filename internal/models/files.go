@@ -0,0 +1,151 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+type SnippetFile struct {
+	Filename string `json:"filename"`
+	Language string `json:"language,omitempty"`
+	Content  string `json:"content"`
+}
+
+// languageExtensions maps common languages to the file extension used when a
+// file has no name of its own.
+var languageExtensions = map[string]string{
+	"bash":       "sh",
+	"c":          "c",
+	"c++":        "cpp",
+	"cpp":        "cpp",
+	"css":        "css",
+	"dockerfile": "dockerfile",
+	"go":         "go",
+	"html":       "html",
+	"java":       "java",
+	"javascript": "js",
+	"json":       "json",
+	"markdown":   "md",
+	"python":     "py",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"shell":      "sh",
+	"sql":        "sql",
+	"typescript": "ts",
+	"yaml":       "yaml",
+}
+
+// extensionLanguages is the reverse of languageExtensions. Where several
+// languages share an extension the alphabetically first one wins.
+var extensionLanguages = func() map[string]string {
+	languages := make([]string, 0, len(languageExtensions))
+	for language := range languageExtensions {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	m := map[string]string{}
+	for _, language := range languages {
+		if _, ok := m[languageExtensions[language]]; !ok {
+			m[languageExtensions[language]] = language
+		}
+	}
+	return m
+}()
+
+// LanguageForFilename guesses the language of a file from its extension and
+// returns an empty string when it doesn't know.
+func LanguageForFilename(filename string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	if ext == "" {
+		ext = strings.ToLower(path.Base(filename))
+	}
+
+	return extensionLanguages[ext]
+}
+
+// DisplayName returns the file name, or a generated one for files that were
+// stored without a name. The position is the index of the file in its snippet.
+func (f SnippetFile) DisplayName(snippetID, position int) string {
+	if f.Filename != "" {
+		return path.Base(f.Filename)
+	}
+
+	ext, ok := languageExtensions[f.Language]
+	if !ok {
+		ext = "txt"
+	}
+
+	if position == 0 {
+		return fmt.Sprintf("snippet-%d.%s", snippetID, ext)
+	}
+	return fmt.Sprintf("snippet-%d-%d.%s", snippetID, position+1, ext)
+}
+
+// Files returns every file of the snippet in order. The first one is the file
+// stored on the snippet row itself.
+func (m *SnippetModel) Files(s Snippet) ([]SnippetFile, error) {
+	files := []SnippetFile{{Filename: s.Filename, Language: s.Language, Content: s.Content}}
+
+	// Files stored before their content was shared still have it inline.
+	stmt := `SELECT snippet_files.filename, snippet_files.language,
+				COALESCE(snippet_contents.content, snippet_files.content), COALESCE(snippet_contents.content_key, '')
+				FROM snippet_files LEFT JOIN snippet_contents ON snippet_contents.sha256 = snippet_files.content_sha256
+				WHERE snippet_files.snippet_id = $1 ORDER BY snippet_files.position`
+
+	rows, err := m.DB.Query(stmt, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		f := SnippetFile{}
+		var key string
+		err = rows.Scan(&f.Filename, &f.Language, &f.Content, &key)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, key := range keys {
+		if key == "" {
+			continue
+		}
+		files[i+1].Content, err = m.readBlob(context.Background(), key)
+		if err != nil {
+			return nil, fmt.Errorf("models: loading file %d of snippet %d: %w", i+2, s.ID, err)
+		}
+	}
+
+	return files, nil
+}
+
+// insertExtraFiles stores every file after the first in snippet_files. sums
+// are the hashes of the content of all the files, which the caller has
+// already acquired.
+func insertExtraFiles(tx *sql.Tx, snippetID int, files []SnippetFile, sums []string) error {
+	stmt := `INSERT INTO snippet_files (snippet_id, position, filename, language, content, content_sha256)
+				VALUES ($1, $2, $3, $4, '', $5)`
+
+	for i, f := range files[1:] {
+		_, err := tx.Exec(stmt, snippetID, i+1, f.Filename, f.Language, sums[i+1])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Fork copies the files of a snippet into a new snippet owned by userID that
+// records where it came from. The fork keeps the title and visibility of the
+// original and lasts as long as it has left, at least a day. Attachments and
+// comments stay with the original.
+func (m *SnippetModel) Fork(parent Snippet, userID int) (int, error) {
+	files, err := m.Files(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	expires := max(int(math.Ceil(time.Until(parent.Expires).Hours()/24)), 1)
+
+	return m.insert(userID, parent.Title, files, parent.Visibility, expires, parent.ID)
+}
+
+// ForkCount returns how many unexpired forks a snippet has that others can
+// see. Private forks are only known to their owners.
+func (m *SnippetModel) ForkCount(id int) (int, error) {
+	stmt := `SELECT COUNT(*) FROM snippets WHERE forked_from = $1 AND expires > NOW() AND visibility <> 'private'`
+
+	var count int
+	err := m.DB.QueryRow(stmt, id).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,212 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxCommentLines is the longest line range a review comment may cover.
+const MaxCommentLines = 500
+
+type LineComment struct {
+	ID        int
+	SnippetID int
+	UserID    int
+	UserName  string
+	// ThreadID is the first comment of the thread for replies, 0 for the
+	// first comment itself.
+	ThreadID  int
+	Version   string
+	Filename  string
+	StartLine int
+	EndLine   int
+	// Excerpt is the commented code as it was when the comment was made.
+	Excerpt  string
+	Body     string
+	Outdated bool
+	Created  time.Time
+}
+
+// Lines names the commented range like the view page anchors do, "L10" or
+// "L10-L25".
+func (c LineComment) Lines() string {
+	if c.StartLine == c.EndLine {
+		return "L" + strconv.Itoa(c.StartLine)
+	}
+	return "L" + strconv.Itoa(c.StartLine) + "-L" + strconv.Itoa(c.EndLine)
+}
+
+type LineCommentModel struct {
+	DB *sql.DB
+}
+
+func NewLineCommentModel(db *sql.DB) *LineCommentModel {
+	return &LineCommentModel{DB: db}
+}
+
+const lineCommentColumns = `line_comments.id, line_comments.snippet_id, line_comments.user_id, users.name,
+	COALESCE(line_comments.thread_id, 0), COALESCE(line_comments.version, ''), line_comments.filename,
+	line_comments.start_line, line_comments.end_line, line_comments.excerpt, line_comments.body,
+	line_comments.outdated, line_comments.created`
+
+// Insert starts a thread on lines start to end of a file in the latest
+// revision of a snippet.
+func (m *LineCommentModel) Insert(snippetID, userID int, filename string, start, end int, excerpt, body string) (int, error) {
+	stmt := `INSERT INTO line_comments (snippet_id, user_id, version, filename, start_line, end_line, excerpt, body)
+				VALUES ($1, $2, (SELECT version FROM snippet_revisions WHERE snippet_id = $1 ORDER BY committed DESC, id DESC LIMIT 1),
+				$3, $4, $5, $6, $7)
+				RETURNING id`
+
+	var id int
+	err := m.DB.QueryRow(stmt, snippetID, userID, filename, start, end, excerpt, body).Scan(&id)
+	return id, err
+}
+
+// Reply adds a comment to the thread started by threadID on a snippet.
+func (m *LineCommentModel) Reply(snippetID, threadID, userID int, body string) (int, error) {
+	stmt := `INSERT INTO line_comments (snippet_id, user_id, thread_id, version, filename, start_line, end_line, excerpt, body, outdated)
+				SELECT snippet_id, $3, id, version, filename, start_line, end_line, excerpt, $4, outdated FROM line_comments
+				WHERE id = $2 AND snippet_id = $1 AND thread_id IS NULL
+				RETURNING id`
+
+	var id int
+	err := m.DB.QueryRow(stmt, snippetID, threadID, userID, body).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoRecord
+	}
+	return id, err
+}
+
+// ForSnippet returns every review comment on a snippet, oldest first.
+func (m *LineCommentModel) ForSnippet(snippetID int) ([]LineComment, error) {
+	stmt := `SELECT ` + lineCommentColumns + ` FROM line_comments JOIN users ON users.id = line_comments.user_id
+				WHERE line_comments.snippet_id = $1 ORDER BY line_comments.created, line_comments.id`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []LineComment{}
+
+	for rows.Next() {
+		c := LineComment{}
+		err = rows.Scan(&c.ID, &c.SnippetID, &c.UserID, &c.UserName, &c.ThreadID, &c.Version, &c.Filename,
+			&c.StartLine, &c.EndLine, &c.Excerpt, &c.Body, &c.Outdated, &c.Created)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// relocateLineComments carries the review comments of a snippet over to a
+// new revision. Comments whose lines are still there, unchanged, are moved to
+// where they are now; the others are marked outdated.
+func relocateLineComments(tx *sql.Tx, snippetID int, version string, before, after []SnippetFile) error {
+	rows, err := tx.Query(`SELECT id, filename, start_line, end_line FROM line_comments
+				WHERE snippet_id = $1 AND NOT outdated FOR UPDATE`, snippetID)
+	if err != nil {
+		return err
+	}
+
+	type location struct {
+		id, start, end int
+		filename       string
+	}
+	var comments []location
+	for rows.Next() {
+		var c location
+		if err = rows.Scan(&c.id, &c.filename, &c.start, &c.end); err != nil {
+			rows.Close()
+			return err
+		}
+		comments = append(comments, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	beforeLines, afterLines := fileLines(snippetID, before), fileLines(snippetID, after)
+
+	for _, c := range comments {
+		start, ok := relocateLines(beforeLines[c.filename], afterLines[c.filename], c.start, c.end)
+		if ok {
+			_, err = tx.Exec(`UPDATE line_comments SET start_line = $1, end_line = $2, version = $3 WHERE id = $4`,
+				start, start+c.end-c.start, version, c.id)
+		} else {
+			_, err = tx.Exec(`UPDATE line_comments SET outdated = TRUE WHERE id = $1`, c.id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fileLines splits each file into lines, keyed by its display name.
+func fileLines(snippetID int, files []SnippetFile) map[string][]string {
+	lines := map[string][]string{}
+	for i, f := range files {
+		lines[f.DisplayName(snippetID, i)] = SplitLines(f.Content)
+	}
+	return lines
+}
+
+// SplitLines splits content into lines the way the view page numbers them.
+func SplitLines(content string) []string {
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// relocateLines finds where lines start to end of before are in after. Lines
+// outside the edited region, found from the common prefix and suffix of the
+// two versions, keep their place relative to it. Lines inside it are looked
+// for and only kept if they appear exactly once.
+func relocateLines(before, after []string, start, end int) (int, bool) {
+	if before == nil || after == nil || start < 1 || end < start || end > len(before) {
+		return 0, false
+	}
+
+	prefix := 0
+	for prefix < min(len(before), len(after)) && before[prefix] == after[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < min(len(before), len(after))-prefix &&
+		before[len(before)-1-suffix] == after[len(after)-1-suffix] {
+		suffix++
+	}
+
+	switch {
+	case end <= prefix:
+		return start, true
+	case start > len(before)-suffix:
+		return start + len(after) - len(before), true
+	}
+
+	block := before[start-1 : end]
+	found := 0
+	for i := 0; i+len(block) <= len(after); i++ {
+		if slices.Equal(after[i:i+len(block)], block) {
+			if found != 0 {
+				return 0, false
+			}
+			found = i + 1
+		}
+	}
+
+	return found, found != 0
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRelocateLines(t *testing.T) {
+	lines := func(s string) []string { return strings.Split(s, " ") }
+	before := lines("a b c d e f g")
+
+	tests := []struct {
+		name       string
+		after      []string
+		start, end int
+		want       int
+		ok         bool
+	}{
+		{"unchanged", before, 2, 4, 2, true},
+		{"before an insert", lines("a b c d x y e f g"), 2, 3, 2, true},
+		{"before a delete", lines("a b c d g"), 1, 4, 1, true},
+		{"after an insert", lines("a x y b c d e f g"), 4, 6, 6, true},
+		{"after a delete", lines("a b e f g"), 6, 7, 4, true},
+		{"after a replace", lines("a x y z c d e f g"), 3, 5, 5, true},
+		{"inside the edit, moved", lines("x a y b c d z e f g"), 3, 4, 5, true},
+		{"inside the edit, changed", lines("a b c x e f g"), 3, 4, 0, false},
+		{"across the edit", lines("a b c x d e f g"), 3, 4, 0, false},
+		{"inside the edit, deleted", lines("a g"), 3, 5, 0, false},
+		{"inside the edit, duplicated", lines("a x c d c d y g"), 3, 4, 0, false},
+		{"duplicated before the edit", lines("a b c d c d e x g"), 3, 4, 3, true},
+		{"whole file", lines("x a b c d e f g"), 1, 7, 2, true},
+		{"last line", lines("a b c d e f g h"), 7, 7, 7, true},
+		{"past the end", before, 7, 8, 0, false},
+		{"starts past the end", before, 9, 9, 0, false},
+		{"backwards", before, 4, 2, 0, false},
+		{"line 0", before, 0, 2, 0, false},
+		{"file removed", nil, 1, 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := relocateLines(before, tt.after, tt.start, tt.end)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got %d, %t; want %d, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRelocateLinesDuplicateBlocks(t *testing.T) {
+	before := strings.Split("} x } y }", " ")
+
+	tests := []struct {
+		name       string
+		after      []string
+		start, end int
+		want       int
+		ok         bool
+	}{
+		// Repeated lines outside the edit keep their place.
+		{"before the edit", strings.Split("} x } z }", " "), 3, 3, 3, true},
+		{"after the edit", strings.Split("} z } y }", " "), 3, 5, 3, true},
+		// Inside it there is no telling which one was meant.
+		{"inside the edit", strings.Split("} x q } q y }", " "), 3, 3, 0, false},
+		{"unique inside the edit", strings.Split("q } x } q y }", " "), 2, 3, 3, true},
+		{"repeated inside the edit", strings.Split("q } x } q y }", " "), 1, 1, 0, false},
+		{"after a repeated insert", strings.Split("} x } x } y }", " "), 4, 5, 6, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := relocateLines(before, tt.after, tt.start, tt.end)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: got %d, %t; want %d, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 1},
+		{"a", 1},
+		{"a\n", 1},
+		{"a\nb", 2},
+		{"a\nb\n\n", 3},
+	}
+
+	for _, tt := range tests {
+		if got := len(SplitLines(tt.in)); got != tt.want {
+			t.Errorf("SplitLines(%q): got %d lines, want %d", tt.in, got, tt.want)
+		}
+	}
+}
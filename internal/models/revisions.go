@@ -0,0 +1,270 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Revision struct {
+	ID        int
+	SnippetID int
+	Version   string
+	UserID    int
+	Title     string
+	Files     []SnippetFile
+	Additions int
+	Deletions int
+	Committed time.Time
+}
+
+// recordRevision stores the files as the newest revision of a snippet,
+// along with how many lines changed since the previous one, and carries the
+// review comments over to it. Every file of the revision holds a reference on
+// its content, like the snippet itself does.
+func (m *SnippetModel) recordRevision(ctx context.Context, tx *sql.Tx, snippetID, userID int, title string, files []SnippetFile) error {
+	var before []SnippetFile
+	var previousID int
+	var raw []byte
+
+	stmt := `SELECT id, files FROM snippet_revisions WHERE snippet_id = $1 ORDER BY committed DESC, id DESC LIMIT 1`
+
+	err := tx.QueryRowContext(ctx, stmt, snippetID).Scan(&previousID, &raw)
+	first := errors.Is(err, sql.ErrNoRows)
+	if err != nil && !first {
+		return err
+	}
+	if !first {
+		previous := []Revision{{ID: previousID}}
+		err = m.revisionFiles(ctx, tx, `snippet_revisions.id = $1`, previousID, previous, [][]byte{raw})
+		if err != nil {
+			return err
+		}
+		before = previous[0].Files
+	}
+
+	additions, deletions := lineChanges(before, files)
+
+	sums, err := m.acquireFiles(ctx, tx, files)
+	if err != nil {
+		return err
+	}
+
+	// Versions only have to be unique, the hash keeps them the same shape as
+	// the git commit ids gist clients expect.
+	sum := sha1.New()
+	fmt.Fprintf(sum, "%d\x00%d", snippetID, time.Now().UnixNano())
+	for i, f := range files {
+		fmt.Fprintf(sum, "\x00%s\x00%s\x00%s", f.Filename, f.Language, sums[i])
+	}
+	version := hex.EncodeToString(sum.Sum(nil))
+
+	stmt = `INSERT INTO snippet_revisions (snippet_id, version, user_id, title, additions, deletions, committed)
+				VALUES ($1, $2, NULLIF($3, 0), $4, $5, $6, NOW())
+				RETURNING id`
+
+	var revisionID int
+	err = tx.QueryRowContext(ctx, stmt, snippetID, version, userID, title, additions, deletions).Scan(&revisionID)
+	if err != nil {
+		return err
+	}
+
+	if err = insertRevisionFiles(ctx, tx, revisionID, files, sums); err != nil {
+		return err
+	}
+
+	if first {
+		return nil
+	}
+
+	return relocateLineComments(tx, snippetID, version, before, files)
+}
+
+// insertRevisionFiles stores the files of a revision. sums are the hashes of
+// their content, which the caller has already acquired.
+func insertRevisionFiles(ctx context.Context, tx *sql.Tx, revisionID int, files []SnippetFile, sums []string) error {
+	stmt := `INSERT INTO snippet_revision_files (revision_id, position, filename, language, content_sha256)
+				VALUES ($1, $2, $3, $4, $5)`
+
+	for i, f := range files {
+		_, err := tx.ExecContext(ctx, stmt, revisionID, i, f.Filename, f.Language, sums[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// lineChanges counts the lines added and removed between two sets of files.
+// Lines are compared per file name as multisets, so moved lines don't count.
+func lineChanges(before, after []SnippetFile) (additions, deletions int) {
+	counts := map[string]int{}
+	for _, f := range before {
+		for _, line := range strings.Split(f.Content, "\n") {
+			counts[f.Filename+"\x00"+line]--
+		}
+	}
+	for _, f := range after {
+		for _, line := range strings.Split(f.Content, "\n") {
+			counts[f.Filename+"\x00"+line]++
+		}
+	}
+
+	for _, n := range counts {
+		if n > 0 {
+			additions += n
+		} else {
+			deletions -= n
+		}
+	}
+
+	return additions, deletions
+}
+
+// scanRevision reads a revision row. raw is the copy of the files kept on
+// revisions recorded before their content was shared, nil on newer ones.
+func scanRevision(row rowScanner) (r Revision, raw []byte, err error) {
+	err = row.Scan(&r.ID, &r.SnippetID, &r.Version, &r.UserID, &r.Title, &raw, &r.Additions, &r.Deletions, &r.Committed)
+	return r, raw, err
+}
+
+const revisionColumns = `id, snippet_id, version, COALESCE(user_id, 0), title, files, additions, deletions, committed`
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// revisionFiles fills in the files of revisions. Those with a raw copy of
+// their files are decoded from it, the rest are read from
+// snippet_revision_files, picking the rows with filter, which takes arg as $1.
+func (m *SnippetModel) revisionFiles(ctx context.Context, q queryer, filter string, arg int, revisions []Revision, raws [][]byte) error {
+	index := map[int]int{}
+	for i := range revisions {
+		if raws[i] != nil {
+			if err := json.Unmarshal(raws[i], &revisions[i].Files); err != nil {
+				return err
+			}
+			continue
+		}
+		index[revisions[i].ID] = i
+	}
+	if len(index) == 0 {
+		return nil
+	}
+
+	stmt := `SELECT snippet_revision_files.revision_id, snippet_revision_files.filename, snippet_revision_files.language,
+				snippet_contents.content, COALESCE(snippet_contents.content_key, '')
+				FROM snippet_revision_files
+				JOIN snippet_revisions ON snippet_revisions.id = snippet_revision_files.revision_id
+				JOIN snippet_contents ON snippet_contents.sha256 = snippet_revision_files.content_sha256
+				WHERE ` + filter + `
+				ORDER BY snippet_revision_files.revision_id, snippet_revision_files.position`
+
+	rows, err := q.QueryContext(ctx, stmt, arg)
+	if err != nil {
+		return err
+	}
+
+	type stored struct{ revision, file int }
+	inBlobs := map[string][]stored{}
+
+	for rows.Next() {
+		var id int
+		var key string
+		f := SnippetFile{}
+		if err = rows.Scan(&id, &f.Filename, &f.Language, &f.Content, &key); err != nil {
+			rows.Close()
+			return err
+		}
+
+		i, ok := index[id]
+		if !ok {
+			continue
+		}
+		revisions[i].Files = append(revisions[i].Files, f)
+		if key != "" {
+			inBlobs[key] = append(inBlobs[key], stored{i, len(revisions[i].Files) - 1})
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// Most files don't change between revisions, so each blob is read once
+	// however many of them share it.
+	for key, files := range inBlobs {
+		content, err := m.readBlob(ctx, key)
+		if err != nil {
+			return fmt.Errorf("models: loading revision content: %w", err)
+		}
+		for _, f := range files {
+			revisions[f.revision].Files[f.file].Content = content
+		}
+	}
+
+	return nil
+}
+
+// Revisions returns the history of a snippet, newest first.
+func (m *SnippetModel) Revisions(snippetID int) ([]Revision, error) {
+	stmt := `SELECT ` + revisionColumns + ` FROM snippet_revisions WHERE snippet_id = $1 ORDER BY committed DESC, id DESC`
+
+	rows, err := m.DB.Query(stmt, snippetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []Revision{}
+	var raws [][]byte
+
+	for rows.Next() {
+		r, raw, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+		raws = append(raws, raw)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = m.revisionFiles(context.Background(), m.DB, `snippet_revisions.snippet_id = $1`, snippetID, revisions, raws)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Revision returns one version of a snippet.
+func (m *SnippetModel) Revision(snippetID int, version string) (Revision, error) {
+	stmt := `SELECT ` + revisionColumns + ` FROM snippet_revisions WHERE snippet_id = $1 AND version = $2`
+
+	r, raw, err := scanRevision(m.DB.QueryRow(stmt, snippetID, version))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, ErrNoRecord
+		}
+		return Revision{}, err
+	}
+
+	revisions := []Revision{r}
+	err = m.revisionFiles(context.Background(), m.DB, `snippet_revisions.id = $1`, r.ID, revisions, [][]byte{raw})
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return revisions[0], nil
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type UserSession struct {
+	ID        int
+	Token     string
+	UserID    int
+	UserAgent string
+	IP        string
+	Created   time.Time
+	LastSeen  time.Time
+	Expires   time.Time
+	// Current is set by handlers for the session making the request.
+	Current bool
+}
+
+type UserSessionModel struct {
+	DB *sql.DB
+}
+
+func NewUserSessionModel(db *sql.DB) *UserSessionModel {
+	return &UserSessionModel{DB: db}
+}
+
+func (m *UserSessionModel) Insert(token string, userID int, userAgent, ip string) error {
+	stmt := `INSERT INTO user_sessions (token, user_id, user_agent, ip, created, last_seen)
+				VALUES ($1, $2, $3, $4, NOW(), NOW())
+				ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, last_seen = NOW()`
+
+	_, err := m.DB.Exec(stmt, token, userID, userAgent, ip)
+	return err
+}
+
+// Touch records activity on a session. The update is skipped when the session
+// was seen within the last minute so busy sessions don't write on every request.
+func (m *UserSessionModel) Touch(token, ip string) error {
+	stmt := `UPDATE user_sessions SET last_seen = NOW(), ip = $2
+				WHERE token = $1 AND last_seen < NOW() - INTERVAL '1 MINUTE'`
+
+	_, err := m.DB.Exec(stmt, token, ip)
+	return err
+}
+
+// Active returns the sessions of a user that still have live session data.
+func (m *UserSessionModel) Active(userID int) ([]UserSession, error) {
+	stmt := `SELECT us.id, us.token, us.user_id, us.user_agent, us.ip, us.created, us.last_seen, s.expiry
+				FROM user_sessions us
+				JOIN sessions s ON s.token = us.token
+				WHERE us.user_id = $1 AND s.expiry > NOW()
+				ORDER BY us.last_seen DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UserSession{}
+
+	for rows.Next() {
+		s := UserSession{}
+		err = rows.Scan(&s.ID, &s.Token, &s.UserID, &s.UserAgent, &s.IP, &s.Created, &s.LastSeen, &s.Expires)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Revoke deletes a single session belonging to the user, including its scs
+// session data, which logs out whoever holds that session cookie.
+func (m *UserSessionModel) Revoke(id, userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var token string
+	err = tx.QueryRow(`DELETE FROM user_sessions WHERE id = $1 AND user_id = $2 RETURNING token`, id, userID).Scan(&token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM sessions WHERE token = $1`, token)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RevokeAll deletes every session of the user.
+func (m *UserSessionModel) RevokeAll(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM sessions WHERE token IN (SELECT token FROM user_sessions WHERE user_id = $1)`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_sessions WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete forgets the metadata of a session that is being logged out.
+func (m *UserSessionModel) Delete(token string) error {
+	_, err := m.DB.Exec(`DELETE FROM user_sessions WHERE token = $1`, token)
+	return err
+}
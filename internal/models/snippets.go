@@ -1,49 +1,204 @@
 package models
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
+	"snippetbox/internal/blobstore"
 	"time"
 )
 
 type Snippet struct {
-	ID      int
-	Title   string
-	Content string
-	Created time.Time
-	Expires time.Time
+	ID       int       `json:"id"`
+	UserID   int       `json:"user_id,omitempty"`
+	Title    string    `json:"title"`
+	Filename string    `json:"filename,omitempty"`
+	Content  string    `json:"content"`
+	Language string    `json:"language,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Expires  time.Time `json:"expires"`
+	// Visibility is one of VisibilityPublic, VisibilityUnlisted and
+	// VisibilityPrivate.
+	Visibility string `json:"visibility"`
+	// ForkedFrom is the snippet this one is a fork of, or 0.
+	ForkedFrom int `json:"forked_from,omitempty"`
+	// Stars is how many users starred the snippet.
+	Stars int `json:"stars"`
+	// Views is how many times the snippet page was viewed.
+	Views int `json:"views"`
+
+	// ContentKey is the blob store key of the content when it is too large
+	// to keep in the database.
+	ContentKey string `json:"-"`
+	// ContentSHA256 is the hash of the content, shared by every snippet with
+	// the same content.
+	ContentSHA256 string `json:"-"`
+}
+
+// Snippet visibilities.
+const (
+	VisibilityPublic   = "public"
+	VisibilityUnlisted = "unlisted"
+	VisibilityPrivate  = "private"
+)
+
+// Visibilities lists every visibility a snippet can have.
+var Visibilities = []string{VisibilityPublic, VisibilityUnlisted, VisibilityPrivate}
+
+// IsPublic reports whether the snippet may show up in listings and link
+// previews.
+func (s Snippet) IsPublic() bool {
+	return s.Visibility == VisibilityPublic
+}
+
+// VisibleTo reports whether the user may view the snippet. A userID of 0 is
+// an anonymous visitor.
+func (s Snippet) VisibleTo(userID int) bool {
+	return s.Visibility != VisibilityPrivate || s.UserID != 0 && s.UserID == userID
+}
+
+// ETag returns a strong entity tag derived from the snippet content.
+func (s Snippet) ETag() string {
+	return ContentETag(s.Content)
+}
+
+// ContentETag returns a strong entity tag for a piece of content.
+func ContentETag(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
 }
 
 type SnippetModel struct {
 	DB *sql.DB
+
+	// Blobs, when set, holds the content of first files larger than
+	// BlobThreshold bytes instead of the content column.
+	Blobs         blobstore.BlobStore
+	BlobThreshold int
 }
 
-func NewSnippetModel(db *sql.DB) *SnippetModel {
+func NewSnippetModel(db *sql.DB, blobs blobstore.BlobStore, blobThreshold int) *SnippetModel {
 	return &SnippetModel{
-		DB: db,
+		DB:            db,
+		Blobs:         blobs,
+		BlobThreshold: blobThreshold,
+	}
+}
+
+// snippetColumns is the column list every query returning whole snippets
+// selects from snippetTables, in the order scanSnippet expects. Snippets
+// created before content was shared still have their own content and key.
+const snippetColumns = `snippets.id, COALESCE(snippets.user_id, 0), snippets.title, snippets.filename,
+	COALESCE(snippet_contents.content, snippets.content), snippets.language, snippets.created, snippets.updated,
+	snippets.expires, COALESCE(snippet_contents.content_key, snippets.content_key, ''),
+	COALESCE(snippets.content_sha256, ''), snippets.visibility, COALESCE(snippets.forked_from, 0),
+	snippets.stars, snippets.views`
+
+const snippetTables = `snippets LEFT JOIN snippet_contents ON snippet_contents.sha256 = snippets.content_sha256`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSnippet(row rowScanner) (Snippet, error) {
+	s := Snippet{}
+	err := row.Scan(&s.ID, &s.UserID, &s.Title, &s.Filename, &s.Content, &s.Language, &s.Created, &s.Updated, &s.Expires, &s.ContentKey, &s.ContentSHA256, &s.Visibility, &s.ForkedFrom, &s.Stars, &s.Views)
+	return s, err
+}
+
+// scanSnippets reads every row and then loads any content kept in the blob
+// store.
+func (m *SnippetModel) scanSnippets(rows *sql.Rows) ([]Snippet, error) {
+	defer rows.Close()
+
+	snippets := []Snippet{}
+
+	for rows.Next() {
+		s, err := scanSnippet(rows)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range snippets {
+		if err := m.loadContent(context.Background(), &snippets[i]); err != nil {
+			return nil, err
+		}
 	}
+
+	return snippets, nil
+}
+
+// Insert stores a new single file snippet. A userID of 0 creates an anonymous
+// snippet.
+func (m *SnippetModel) Insert(userID int, title, content, language, visibility string, expires int) (int, error) {
+	return m.InsertFiles(userID, title, []SnippetFile{{Content: content, Language: language}}, visibility, expires)
+}
+
+// InsertFiles stores a new snippet made of one or more files and records its
+// first revision.
+func (m *SnippetModel) InsertFiles(userID int, title string, files []SnippetFile, visibility string, expires int) (int, error) {
+	return m.insert(userID, title, files, visibility, expires, 0)
 }
 
-func (m *SnippetModel) Insert(title, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-				VALUES($1, $2, NOW(), NOW() + $3 * INTERVAL '1 DAY') RETURNING id`
+// insert stores a new snippet, a fork of forkedFrom unless that is 0.
+func (m *SnippetModel) insert(userID int, title string, files []SnippetFile, visibility string, expires, forkedFrom int) (int, error) {
+	ctx := context.Background()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	sums, err := m.acquireFiles(ctx, tx, files)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `INSERT INTO snippets (user_id, title, filename, content, content_sha256, language, visibility,
+				created, updated, expires, forked_from)
+				VALUES(NULLIF($1, 0), $2, $3, '', $4, $5, $6, NOW(), NOW(), NOW() + $7 * INTERVAL '1 DAY', NULLIF($8, 0))
+				RETURNING id`
 	var lastInsertID int
 
 	// Execute the query and scan the result into lastInsertID
-	err := m.DB.QueryRow(stmt, title, content, expires).Scan(&lastInsertID)
+	err = tx.QueryRow(stmt, userID, title, files[0].Filename, sums[0], files[0].Language, visibility, expires, forkedFrom).Scan(&lastInsertID)
 	if err != nil {
 		return 0, err
 	}
 
+	err = insertExtraFiles(tx, lastInsertID, files, sums)
+	if err != nil {
+		return 0, err
+	}
+
+	err = m.recordRevision(ctx, tx, lastInsertID, userID, title, files)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
 	// Return the last inserted ID
 	return lastInsertID, nil
 }
 
 func (m *SnippetModel) Get(id int) (Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > NOW() AND id = $1`
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + ` WHERE snippets.expires > NOW() AND snippets.id = $1`
 
-	s := Snippet{}
-	err := m.DB.QueryRow(stmt, id).Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	s, err := scanSnippet(m.DB.QueryRow(stmt, id))
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -53,33 +208,209 @@ func (m *SnippetModel) Get(id int) (Snippet, error) {
 		}
 	}
 
+	if err = m.loadContent(context.Background(), &s); err != nil {
+		return Snippet{}, err
+	}
+
 	return s, nil
 }
 
 func (m *SnippetModel) Latest() ([]Snippet, error) {
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > NOW() ORDER BY created DESC LIMIT 10`
+	return m.List(10, 0)
+}
 
-	rows, err := m.DB.Query(stmt)
+// List returns a page of unexpired public snippets, newest first.
+func (m *SnippetModel) List(limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				WHERE snippets.expires > NOW() AND snippets.visibility = 'public'
+				ORDER BY snippets.created DESC LIMIT $1 OFFSET $2`
 
+	rows, err := m.DB.Query(stmt, limit, offset)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	snippets := []Snippet{}
+	return m.scanSnippets(rows)
+}
 
-	for rows.Next() {
-		s := Snippet{}
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
-		if err != nil {
-			return nil, err
-		}
-		snippets = append(snippets, s)
+// ForUser returns a page of the unexpired snippets owned by a user, whatever
+// their visibility, most recently updated first.
+func (m *SnippetModel) ForUser(userID, limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				WHERE snippets.expires > NOW() AND snippets.user_id = $1
+				ORDER BY snippets.updated DESC LIMIT $2 OFFSET $3`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
+	return m.scanSnippets(rows)
+}
+
+// StarredBy returns a page of the unexpired snippets a user starred that they
+// can still see, most recently starred first.
+func (m *SnippetModel) StarredBy(userID, limit, offset int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				JOIN stars ON stars.snippet_id = snippets.id
+				WHERE stars.user_id = $1 AND snippets.expires > NOW()
+				AND (snippets.visibility <> 'private' OR snippets.user_id = $1)
+				ORDER BY stars.created DESC LIMIT $2 OFFSET $3`
+
+	rows, err := m.DB.Query(stmt, userID, limit, offset)
+	if err != nil {
 		return nil, err
 	}
 
-	return snippets, nil
+	return m.scanSnippets(rows)
+}
+
+// InCollection returns the unexpired snippets of a collection that viewerID
+// can see, in the order the collection keeps them.
+func (m *SnippetModel) InCollection(collectionID, viewerID int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				JOIN collection_snippets ON collection_snippets.snippet_id = snippets.id
+				WHERE collection_snippets.collection_id = $1 AND snippets.expires > NOW()
+				AND (snippets.visibility <> 'private' OR snippets.user_id = $2)
+				ORDER BY collection_snippets.position`
+
+	rows, err := m.DB.Query(stmt, collectionID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.scanSnippets(rows)
+}
+
+// Update replaces the title, visibility and first file of a snippet owned by
+// userID and restarts its expiry period. Any further files are left as they
+// are.
+func (m *SnippetModel) Update(id, userID int, title, content, language, visibility string, expires int) error {
+	s, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	files, err := m.Files(s)
+	if err != nil {
+		return err
+	}
+	files[0].Content = content
+	files[0].Language = language
+
+	return m.UpdateFiles(id, userID, title, files, visibility, expires)
+}
+
+// UpdateFiles replaces the title, visibility and every file of a snippet owned
+// by userID, restarts its expiry period and records a new revision.
+func (m *SnippetModel) UpdateFiles(id, userID int, title string, files []SnippetFile, visibility string, expires int) error {
+	ctx := context.Background()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previousKey, previousSum string
+
+	stmt := `SELECT COALESCE(content_key, ''), COALESCE(content_sha256, '') FROM snippets
+				WHERE id = $1 AND user_id = $2 AND expires > NOW() FOR UPDATE`
+
+	err = tx.QueryRow(stmt, id, userID).Scan(&previousKey, &previousSum)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	// Take the new reference before dropping the old one so content that
+	// didn't change is never released.
+	sums, err := m.acquireFiles(ctx, tx, files)
+	if err != nil {
+		return err
+	}
+
+	if err = releaseContent(ctx, tx, previousSum); err != nil {
+		return err
+	}
+
+	if err = releaseFiles(ctx, tx, id, false); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = $1, filename = $2, content = '', content_key = NULL, content_sha256 = $3,
+				language = $4, visibility = $5, updated = NOW(), expires = NOW() + $6 * INTERVAL '1 DAY'
+				WHERE id = $7`
+
+	_, err = tx.Exec(stmt, title, files[0].Filename, sums[0], files[0].Language, visibility, expires, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM snippet_files WHERE snippet_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertExtraFiles(tx, id, files, sums)
+	if err != nil {
+		return err
+	}
+
+	err = m.recordRevision(ctx, tx, id, userID, title, files)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	m.dropContent(ctx, previousKey)
+
+	return nil
+}
+
+func (m *SnippetModel) Delete(id, userID int) error {
+	ctx := context.Background()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The files and revisions go with the snippet, so their references are
+	// dropped first. Should the snippet not be userID's, the transaction is
+	// rolled back and they are kept.
+	if err = releaseFiles(ctx, tx, id, true); err != nil {
+		return err
+	}
+
+	var key, sum string
+
+	stmt := `DELETE FROM snippets WHERE id = $1 AND user_id = $2
+				RETURNING COALESCE(content_key, ''), COALESCE(content_sha256, '')`
+
+	err = tx.QueryRow(stmt, id, userID).Scan(&key, &sum)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+
+	if err = releaseContent(ctx, tx, sum); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	m.dropContent(ctx, key)
+
+	return nil
 }
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+type StarModel struct {
+	DB *sql.DB
+}
+
+func NewStarModel(db *sql.DB) *StarModel {
+	return &StarModel{DB: db}
+}
+
+// Star records that a user starred a snippet. Starring a snippet twice
+// changes nothing. The primary key makes concurrent requests for the same
+// star wait for each other, so only the one that inserted the row counts it.
+func (m *StarModel) Star(userID, snippetID int) error {
+	return m.set(userID, snippetID,
+		`INSERT INTO stars (user_id, snippet_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		`UPDATE snippets SET stars = stars + 1 WHERE id = $1`)
+}
+
+// Unstar removes a star, if there is one.
+func (m *StarModel) Unstar(userID, snippetID int) error {
+	return m.set(userID, snippetID,
+		`DELETE FROM stars WHERE user_id = $1 AND snippet_id = $2`,
+		`UPDATE snippets SET stars = stars - 1 WHERE id = $1`)
+}
+
+// set runs change and, in the same transaction, adjusts the count on the
+// snippet when it affected a row.
+func (m *StarModel) set(userID, snippetID int, change, count string) error {
+	tx, err := m.DB.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(change, userID, snippetID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		if _, err = tx.Exec(count, snippetID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Starred reports whether a user starred a snippet.
+func (m *StarModel) Starred(userID, snippetID int) (bool, error) {
+	stmt := `SELECT EXISTS (SELECT 1 FROM stars WHERE user_id = $1 AND snippet_id = $2)`
+
+	var starred bool
+	err := m.DB.QueryRow(stmt, userID, snippetID).Scan(&starred)
+	return starred, err
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Scopes that can be granted to a personal API token.
+const (
+	ScopeSnippetsRead  = "snippets:read"
+	ScopeSnippetsWrite = "snippets:write"
+	ScopeProfile       = "profile"
+)
+
+var Scopes = []string{ScopeSnippetsRead, ScopeSnippetsWrite, ScopeProfile}
+
+// Every token starts with this prefix so leaked tokens are easy to recognise
+// by secret scanners.
+const tokenPrefix = "sbx_"
+
+type APIToken struct {
+	ID       int
+	UserID   int
+	Name     string
+	Scopes   []string
+	Created  time.Time
+	LastUsed sql.NullTime
+}
+
+type APITokenModel struct {
+	DB *sql.DB
+}
+
+func NewAPITokenModel(db *sql.DB) *APITokenModel {
+	return &APITokenModel{DB: db}
+}
+
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// Insert generates a new token for the user and returns its plaintext. The
+// plaintext is never stored and cannot be recovered later.
+func (m *APITokenModel) Insert(userID int, name string, scopes []string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	plaintext := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	stmt := `INSERT INTO api_tokens (user_id, name, token_hash, scopes, created)
+				VALUES ($1, $2, $3, $4, NOW())`
+
+	_, err := m.DB.Exec(stmt, userID, name, hashToken(plaintext), pq.Array(scopes))
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Authenticate looks up the token matching the plaintext and marks it as used.
+func (m *APITokenModel) Authenticate(plaintext string) (APIToken, error) {
+	stmt := `UPDATE api_tokens SET last_used = NOW() WHERE token_hash = $1
+				RETURNING id, user_id, name, scopes, created, last_used`
+
+	t := APIToken{}
+	err := m.DB.QueryRow(stmt, hashToken(plaintext)).Scan(&t.ID, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.Created, &t.LastUsed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return APIToken{}, ErrNoRecord
+		}
+		return APIToken{}, err
+	}
+
+	return t, nil
+}
+
+func (m *APITokenModel) ForUser(userID int) ([]APIToken, error) {
+	stmt := `SELECT id, user_id, name, scopes, created, last_used FROM api_tokens
+				WHERE user_id = $1 ORDER BY created DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+
+	for rows.Next() {
+		t := APIToken{}
+		err = rows.Scan(&t.ID, &t.UserID, &t.Name, pq.Array(&t.Scopes), &t.Created, &t.LastUsed)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (m *APITokenModel) Delete(id, userID int) error {
+	result, err := m.DB.Exec(`DELETE FROM api_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// A star counts for as much as starWeight views in popularity scores.
+const starWeight = 5
+
+// TrendingWindow is a period snippets are ranked over. Views and stars in it
+// count for less the older they are, losing half their weight every
+// HalfLife. A Period of 0 covers all time and doesn't decay.
+type TrendingWindow struct {
+	Name     string
+	Title    string
+	Period   time.Duration
+	HalfLife time.Duration
+}
+
+// TrendingWindows are the windows offered on the trending page, the default
+// first.
+var TrendingWindows = []TrendingWindow{
+	{Name: "day", Title: "Today", Period: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Name: "week", Title: "This week", Period: 7 * 24 * time.Hour, HalfLife: 2 * 24 * time.Hour},
+	{Name: "all", Title: "All time"},
+}
+
+// ComputeScores replaces the scores of a window with fresh ones for every
+// public, unexpired snippet that was viewed or starred in it, and returns
+// how many snippets have a score.
+func (m *SnippetModel) ComputeScores(ctx context.Context, w TrendingWindow) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM snippet_scores WHERE period = $1`, w.Name); err != nil {
+		return 0, err
+	}
+
+	var stmt string
+	var args []any
+	if w.Period == 0 {
+		stmt = `INSERT INTO snippet_scores (period, snippet_id, score, computed)
+					SELECT $1, id, views + $2 * stars, NOW() FROM snippets
+					WHERE visibility = 'public' AND expires > NOW() AND (views > 0 OR stars > 0)`
+		args = []any{w.Name, starWeight}
+	} else {
+		// Each view and star is weighted by 0.5 ^ (age / half-life).
+		stmt = `INSERT INTO snippet_scores (period, snippet_id, score, computed)
+					SELECT $1, snippets.id, COALESCE(v.score, 0) + $2 * COALESCE(s.score, 0), NOW()
+					FROM snippets
+					LEFT JOIN (
+						SELECT snippet_id, SUM(views * POWER(0.5, EXTRACT(EPOCH FROM NOW() - hour) / $4)) AS score
+						FROM snippet_views WHERE hour > NOW() - $3 * INTERVAL '1 second' GROUP BY snippet_id
+					) AS v ON v.snippet_id = snippets.id
+					LEFT JOIN (
+						SELECT snippet_id, SUM(POWER(0.5, EXTRACT(EPOCH FROM NOW() - created) / $4)) AS score
+						FROM stars WHERE created > NOW() - $3 * INTERVAL '1 second' GROUP BY snippet_id
+					) AS s ON s.snippet_id = snippets.id
+					WHERE snippets.visibility = 'public' AND snippets.expires > NOW()
+					AND (v.score IS NOT NULL OR s.score IS NOT NULL)`
+		args = []any{w.Name, starWeight, w.Period.Seconds(), w.HalfLife.Seconds()}
+	}
+
+	result, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+// PruneViews deletes the hourly view counts older than age, which no window
+// looks at anymore. The totals on the snippets are kept.
+func (m *SnippetModel) PruneViews(ctx context.Context, age time.Duration) (int, error) {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM snippet_views WHERE hour < NOW() - $1 * INTERVAL '1 second'`,
+		age.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Trending returns the highest scoring snippets of a window as of the last
+// time the scores were computed. Snippets made unlisted or private since, or
+// that expired, are left out.
+func (m *SnippetModel) Trending(window string, limit int) ([]Snippet, error) {
+	stmt := `SELECT ` + snippetColumns + ` FROM ` + snippetTables + `
+				JOIN snippet_scores ON snippet_scores.snippet_id = snippets.id
+				WHERE snippet_scores.period = $1 AND snippets.visibility = 'public' AND snippets.expires > NOW()
+				ORDER BY snippet_scores.score DESC, snippets.created DESC LIMIT $2`
+
+	rows, err := m.DB.Query(stmt, window, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.scanSnippets(rows)
+}
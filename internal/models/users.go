@@ -12,14 +12,14 @@ import (
 )
 
 type User struct {
-	ID             int
-	Name           string
-	Username       string
-	Email          string
-	Password       string
-	Created        string
-	Updated        string
-	HashedPassword string
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	Username       string `json:"username,omitempty"`
+	Email          string `json:"email"`
+	Password       string `json:"-"`
+	Created        string `json:"created"`
+	Updated        string `json:"updated"`
+	HashedPassword string `json:"-"`
 }
 
 type UserModel struct {
@@ -104,12 +104,17 @@ func (m *UserModel) Update(id int, name, email string) error {
 	return nil
 }
 
+// UpdatePassword replaces the password of a user with a hash of password.
 func (m *UserModel) UpdatePassword(id int, password string) error {
+	hashed_password, err := bycrptyp.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return err
+	}
 	query := `
 		UPDATE users
 		SET hashed_password = $1, updated = NOW()
 		WHERE id = $2`
-	_, err := m.DB.Exec(query, password, id)
+	_, err = m.DB.Exec(query, string(hashed_password), id)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,73 @@
+// Package moderation holds the hooks that look at comments before they are
+// shown. Hooks can let a comment through, hold it for the snippet owner to
+// approve or turn it down.
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type Verdict int
+
+// Verdicts, from the most to the least lenient.
+const (
+	Publish Verdict = iota
+	Hold
+	Reject
+)
+
+// Submission is a comment about to be stored, new or edited.
+type Submission struct {
+	SnippetID int
+	UserID    int
+	Body      string
+	Edit      bool
+}
+
+// Hook reviews a submission. The reason is shown to the author of rejected
+// comments.
+type Hook interface {
+	Review(ctx context.Context, s Submission) (verdict Verdict, reason string, err error)
+}
+
+// HookFunc adapts a function to a Hook.
+type HookFunc func(ctx context.Context, s Submission) (Verdict, string, error)
+
+func (f HookFunc) Review(ctx context.Context, s Submission) (Verdict, string, error) {
+	return f(ctx, s)
+}
+
+// Chain runs hooks in order and returns the strictest verdict. It stops at
+// the first rejection.
+type Chain []Hook
+
+func (c Chain) Review(ctx context.Context, s Submission) (Verdict, string, error) {
+	verdict, reason := Publish, ""
+	for _, hook := range c {
+		v, r, err := hook.Review(ctx, s)
+		if err != nil {
+			return Publish, "", err
+		}
+		if v > verdict {
+			verdict, reason = v, r
+		}
+		if verdict == Reject {
+			break
+		}
+	}
+
+	return verdict, reason, nil
+}
+
+// MaxLinks holds comments with more than n links, the usual mark of spam.
+func MaxLinks(n int) Hook {
+	return HookFunc(func(ctx context.Context, s Submission) (Verdict, string, error) {
+		body := strings.ToLower(s.Body)
+		if strings.Count(body, "http://")+strings.Count(body, "https://") > n {
+			return Hold, fmt.Sprintf("more than %d links", n), nil
+		}
+		return Publish, "", nil
+	})
+}
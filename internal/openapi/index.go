@@ -0,0 +1,148 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Document holds the parts of an OpenAPI 3.1 document that the docs page and
+// the route check need. The raw file is what gets served to clients.
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components struct {
+		Schemas map[string]Schema `json:"schemas"`
+	} `json:"components"`
+	Raw []byte `json:"-"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type Operation struct {
+	OperationID string              `json:"operationId"`
+	Summary     string              `json:"summary"`
+	Description string              `json:"description"`
+	Parameters  []Parameter         `json:"parameters"`
+	RequestBody *RequestBody        `json:"requestBody"`
+	Responses   map[string]Response `json:"responses"`
+	Scopes      []string            `json:"x-scopes"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type RequestBody struct {
+	Content map[string]struct {
+		Schema Schema `json:"schema"`
+	} `json:"content"`
+}
+
+type Response struct {
+	Description string `json:"description"`
+}
+
+type Schema struct {
+	Ref         string            `json:"$ref"`
+	Type        any               `json:"type"`
+	Description string            `json:"description"`
+	Properties  map[string]Schema `json:"properties"`
+	Required    []string          `json:"required"`
+}
+
+// Endpoint is a single operation flattened for display.
+type Endpoint struct {
+	Method string
+	Path   string
+	Operation
+}
+
+// Load reads and parses the document at path.
+func Load(path string) (*Document, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{Raw: raw}
+	err = json.Unmarshal(raw, doc)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: parsing %s: %w", path, err)
+	}
+
+	return doc, nil
+}
+
+// Endpoints lists every operation in the document ordered by path and method.
+func (d *Document) Endpoints() []Endpoint {
+	endpoints := []Endpoint{}
+	for path, operations := range d.Paths {
+		for method, operation := range operations {
+			endpoints = append(endpoints, Endpoint{
+				Method:    strings.ToUpper(method),
+				Path:      path,
+				Operation: operation,
+			})
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Path != endpoints[j].Path {
+			return endpoints[i].Path < endpoints[j].Path
+		}
+		return endpoints[i].Method < endpoints[j].Method
+	})
+
+	return endpoints
+}
+
+// CheckRoutes compares the ServeMux patterns registered under prefix, like
+// "GET /snippets/{id}", with the operations in the document and returns an
+// error naming every route that only one side knows about. Patterns without a
+// method are catch-alls and are ignored.
+func (d *Document) CheckRoutes(prefix string, patterns []string) error {
+	registered := []string{}
+	for _, pattern := range patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok {
+			continue
+		}
+		registered = append(registered, method+" "+prefix+path)
+	}
+
+	documented := []string{}
+	for _, endpoint := range d.Endpoints() {
+		documented = append(documented, endpoint.Method+" "+endpoint.Path)
+	}
+
+	var problems []string
+	for _, route := range registered {
+		if !slices.Contains(documented, route) {
+			problems = append(problems, "undocumented route "+route)
+		}
+	}
+	for _, route := range documented {
+		if !slices.Contains(registered, route) {
+			problems = append(problems, "documented route "+route+" is not registered")
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("openapi: spec and routes differ: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
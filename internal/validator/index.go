@@ -10,6 +10,9 @@ import (
 
 var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
+// LanguageRX matches language names such as "go", "c++" or "objective-c".
+var LanguageRX = regexp.MustCompile(`^[a-z0-9][a-z0-9+#._-]{0,29}$`)
+
 type Validator struct {
 	NonFieldErrors []string
 	FieldErrors    map[string]string
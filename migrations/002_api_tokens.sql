@@ -0,0 +1,13 @@
+-- Personal API tokens. Only the SHA-256 hash of a token is stored, the
+-- plaintext is shown to the user once when the token is created.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id);
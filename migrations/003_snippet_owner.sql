@@ -0,0 +1,5 @@
+-- Record who created a snippet. Snippets created before this column existed
+-- have no owner and cannot be changed through the API.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS snippets_user_id_idx ON snippets (user_id);
@@ -0,0 +1,5 @@
+-- Track when a snippet last changed so raw downloads can send Last-Modified.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS updated TIMESTAMP;
+UPDATE snippets SET updated = created WHERE updated IS NULL;
+ALTER TABLE snippets ALTER COLUMN updated SET DEFAULT NOW();
+ALTER TABLE snippets ALTER COLUMN updated SET NOT NULL;
@@ -0,0 +1,3 @@
+-- Optional language of a snippet, used for syntax highlighting and file
+-- extensions. Empty when unknown.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS language VARCHAR(30) NOT NULL DEFAULT '';
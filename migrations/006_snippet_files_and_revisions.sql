@@ -0,0 +1,30 @@
+-- A snippet is made of one or more files. The first file lives in the
+-- snippets row itself (filename, language, content) so single file snippets
+-- need nothing else, any further files are stored here in order.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS filename VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS snippet_files (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    language VARCHAR(30) NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    UNIQUE (snippet_id, position)
+);
+
+-- Every create and update of a snippet stores a full copy of its files so
+-- the history can be listed and old versions retrieved.
+CREATE TABLE IF NOT EXISTS snippet_revisions (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    version CHAR(40) NOT NULL UNIQUE,
+    user_id INTEGER REFERENCES users (id) ON DELETE SET NULL,
+    title VARCHAR(100) NOT NULL,
+    files JSONB NOT NULL,
+    additions INTEGER NOT NULL DEFAULT 0,
+    deletions INTEGER NOT NULL DEFAULT 0,
+    committed TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS snippet_revisions_snippet_id_idx ON snippet_revisions (snippet_id, committed DESC);
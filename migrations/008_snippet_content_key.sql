@@ -0,0 +1,3 @@
+-- Content above the configured size threshold is kept in the blob store. Such
+-- rows have an empty content column and the key of the blob in content_key.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS content_key TEXT;
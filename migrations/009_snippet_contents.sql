@@ -0,0 +1,33 @@
+-- Snippet bodies are stored once per distinct content, keyed by its SHA-256,
+-- and shared by every snippet with the same content. refs counts the
+-- snippets pointing at a row. Rows that drop to zero references get a
+-- released time and are removed by the expiry worker after a grace period.
+-- Large content is kept in the blob store under content_key, like before.
+CREATE TABLE IF NOT EXISTS snippet_contents (
+    sha256 CHAR(64) PRIMARY KEY,
+    content TEXT NOT NULL DEFAULT '',
+    content_key TEXT,
+    size BIGINT NOT NULL,
+    refs INTEGER NOT NULL DEFAULT 0 CHECK (refs >= 0),
+    created TIMESTAMP NOT NULL DEFAULT NOW(),
+    released TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS snippet_contents_released_idx ON snippet_contents (released) WHERE refs = 0;
+
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS content_sha256 CHAR(64) REFERENCES snippet_contents (sha256);
+
+CREATE INDEX IF NOT EXISTS snippets_content_sha256_idx ON snippets (content_sha256);
+CREATE INDEX IF NOT EXISTS snippets_expires_idx ON snippets (expires);
+
+-- Move the content of existing snippets into the new table. Snippets whose
+-- content was already moved to the blob store keep their own content_key.
+INSERT INTO snippet_contents (sha256, content, size, refs, created)
+    SELECT encode(sha256(convert_to(content, 'UTF8')), 'hex'), content, octet_length(content), COUNT(*), MIN(created)
+    FROM snippets
+    WHERE content_key IS NULL AND content_sha256 IS NULL
+    GROUP BY content
+ON CONFLICT (sha256) DO NOTHING;
+
+UPDATE snippets SET content_sha256 = encode(sha256(convert_to(content, 'UTF8')), 'hex'), content = ''
+    WHERE content_key IS NULL AND content_sha256 IS NULL;
@@ -0,0 +1,5 @@
+-- Images attached to a snippet are shown inline. Their dimensions are kept
+-- for the img tags and thumb_key points at a scaled down copy for listings.
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE attachments ADD COLUMN IF NOT EXISTS thumb_key TEXT;
@@ -0,0 +1,7 @@
+-- Public snippets are listed everywhere. Unlisted ones can be viewed by
+-- anyone with the link but are kept out of listings and link previews.
+-- Private ones can only be viewed by their owner.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private'));
+
+CREATE INDEX IF NOT EXISTS snippets_public_created_idx ON snippets (created DESC) WHERE visibility = 'public';
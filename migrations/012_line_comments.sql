@@ -0,0 +1,22 @@
+-- Review comments on a line range of one file of a snippet. The range is
+-- relative to the revision in version. When a snippet is edited, comments
+-- whose lines survive are moved along with them to the new revision, the
+-- others are marked outdated and keep pointing at the revision they were
+-- made on. Replies share the range of the first comment of their thread.
+CREATE TABLE IF NOT EXISTS line_comments (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    thread_id INTEGER REFERENCES line_comments (id) ON DELETE CASCADE,
+    version CHAR(40),
+    filename VARCHAR(255) NOT NULL,
+    start_line INTEGER NOT NULL,
+    end_line INTEGER NOT NULL,
+    excerpt TEXT NOT NULL DEFAULT '',
+    body TEXT NOT NULL,
+    outdated BOOLEAN NOT NULL DEFAULT FALSE,
+    created TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (start_line >= 1 AND end_line >= start_line)
+);
+
+CREATE INDEX IF NOT EXISTS line_comments_snippet_id_idx ON line_comments (snippet_id, created);
@@ -0,0 +1,15 @@
+-- The discussion under a snippet. Bodies are stored as the Markdown that was
+-- written and rendered when shown. Comments a moderation hook holds back are
+-- pending until the snippet owner approves them, and owners can hide
+-- comments on their snippets.
+CREATE TABLE IF NOT EXISTS comments (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'published' CHECK (status IN ('published', 'pending', 'hidden')),
+    created TIMESTAMP NOT NULL DEFAULT NOW(),
+    edited TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS comments_snippet_id_idx ON comments (snippet_id, created);
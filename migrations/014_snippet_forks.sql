@@ -0,0 +1,5 @@
+-- A fork is a copy of another snippet that remembers where it came from.
+-- Forks outlive their parent, which just stops being linked.
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS forked_from INTEGER REFERENCES snippets (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS snippets_forked_from_idx ON snippets (forked_from) WHERE forked_from IS NOT NULL;
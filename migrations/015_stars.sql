@@ -0,0 +1,17 @@
+-- Users star the snippets they want to find again. The count is kept on the
+-- snippet itself so listings don't have to count stars for every row.
+CREATE TABLE IF NOT EXISTS stars (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    created TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, snippet_id)
+);
+
+CREATE INDEX IF NOT EXISTS stars_snippet_id_idx ON stars (snippet_id);
+CREATE INDEX IF NOT EXISTS stars_user_id_created_idx ON stars (user_id, created DESC);
+
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS stars INTEGER NOT NULL DEFAULT 0 CHECK (stars >= 0);
+
+UPDATE snippets SET stars = counts.n
+    FROM (SELECT snippet_id, COUNT(*) AS n FROM stars GROUP BY snippet_id) AS counts
+    WHERE counts.snippet_id = snippets.id;
@@ -0,0 +1,24 @@
+-- Views of each snippet are counted per hour, which is as fine as trending
+-- scores need, and in total on the snippet. Hourly counts older than the
+-- longest trending window are pruned.
+CREATE TABLE IF NOT EXISTS snippet_views (
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    hour TIMESTAMP NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (snippet_id, hour)
+);
+
+CREATE INDEX IF NOT EXISTS snippet_views_hour_idx ON snippet_views (hour);
+
+ALTER TABLE snippets ADD COLUMN IF NOT EXISTS views BIGINT NOT NULL DEFAULT 0;
+
+-- Popularity scores per trending window, recomputed in the background.
+CREATE TABLE IF NOT EXISTS snippet_scores (
+    period VARCHAR(10) NOT NULL,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (period, snippet_id)
+);
+
+CREATE INDEX IF NOT EXISTS snippet_scores_rank_idx ON snippet_scores (period, score DESC);
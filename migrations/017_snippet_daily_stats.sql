@@ -0,0 +1,10 @@
+-- Views and an estimate of unique visitors per snippet and day, for the stats
+-- page. Visitors are kept as a HyperLogLog sketch of salted hashes, which
+-- can be counted and merged but not traced back to anyone.
+CREATE TABLE IF NOT EXISTS snippet_daily_stats (
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    visitors BYTEA,
+    PRIMARY KEY (snippet_id, day)
+);
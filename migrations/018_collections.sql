@@ -0,0 +1,27 @@
+-- Users group snippets into named collections, kept in the order they
+-- arrange them in. Collections have a visibility of their own, like
+-- snippets: public ones are listed on the snippets they hold, unlisted ones
+-- can be viewed by anyone with the link and private ones only by their owner.
+CREATE TABLE IF NOT EXISTS collections (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility VARCHAR(10) NOT NULL DEFAULT 'public'
+        CHECK (visibility IN ('public', 'unlisted', 'private')),
+    created TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS collections_user_id_idx ON collections (user_id, name);
+
+CREATE TABLE IF NOT EXISTS collection_snippets (
+    collection_id INTEGER NOT NULL REFERENCES collections (id) ON DELETE CASCADE,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    added TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (collection_id, snippet_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_snippets_position_idx ON collection_snippets (collection_id, position);
+CREATE INDEX IF NOT EXISTS collection_snippets_snippet_id_idx ON collection_snippets (snippet_id);
@@ -0,0 +1,63 @@
+-- Every file is stored in snippet_contents, not just the first one of a
+-- snippet. Extra files and the files of each revision point at their content
+-- by hash and hold a reference on it like snippets do, so identical bodies
+-- are kept once, large ones go to the blob store and all of them are
+-- collected once nothing references them.
+ALTER TABLE snippet_files ADD COLUMN IF NOT EXISTS content_sha256 CHAR(64) REFERENCES snippet_contents (sha256);
+ALTER TABLE snippet_files ALTER COLUMN content SET DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS snippet_files_content_sha256_idx ON snippet_files (content_sha256);
+
+CREATE TABLE IF NOT EXISTS snippet_revision_files (
+    revision_id INTEGER NOT NULL REFERENCES snippet_revisions (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    language VARCHAR(30) NOT NULL DEFAULT '',
+    content_sha256 CHAR(64) NOT NULL REFERENCES snippet_contents (sha256),
+    PRIMARY KEY (revision_id, position)
+);
+
+CREATE INDEX IF NOT EXISTS snippet_revision_files_content_sha256_idx ON snippet_revision_files (content_sha256);
+
+-- Revisions keep a copy of their files in files only until it is moved to
+-- snippet_revision_files below.
+ALTER TABLE snippet_revisions ALTER COLUMN files DROP NOT NULL;
+
+-- Move the content of existing extra files and revisions into the shared
+-- table. Bodies above the blob threshold stay in Postgres until
+-- cmd/migrate-blobs moves them.
+INSERT INTO snippet_contents (sha256, content, size, refs, created)
+    SELECT encode(sha256(convert_to(content, 'UTF8')), 'hex'), content, octet_length(content), 0, NOW()
+    FROM (
+        SELECT content FROM snippet_files WHERE content_sha256 IS NULL
+        UNION
+        SELECT file->>'content' FROM snippet_revisions, jsonb_array_elements(files) AS file WHERE files IS NOT NULL
+    ) AS bodies
+ON CONFLICT (sha256) DO NOTHING;
+
+UPDATE snippet_files SET content_sha256 = encode(sha256(convert_to(content, 'UTF8')), 'hex'), content = ''
+    WHERE content_sha256 IS NULL;
+
+INSERT INTO snippet_revision_files (revision_id, position, filename, language, content_sha256)
+    SELECT snippet_revisions.id, file.position - 1, COALESCE(file.body->>'filename', ''), COALESCE(file.body->>'language', ''),
+        encode(sha256(convert_to(file.body->>'content', 'UTF8')), 'hex')
+    FROM snippet_revisions, jsonb_array_elements(files) WITH ORDINALITY AS file (body, position)
+    WHERE files IS NOT NULL
+ON CONFLICT (revision_id, position) DO NOTHING;
+
+UPDATE snippet_revisions SET files = NULL WHERE files IS NOT NULL;
+
+-- Count the references again now that files and revisions hold them too.
+UPDATE snippet_contents SET refs = held.n, released = NULL
+    FROM (
+        SELECT sha256, COUNT(*) AS n FROM (
+            SELECT content_sha256 AS sha256 FROM snippets
+            UNION ALL
+            SELECT content_sha256 FROM snippet_files
+            UNION ALL
+            SELECT content_sha256 FROM snippet_revision_files
+        ) AS refs
+        WHERE sha256 IS NOT NULL
+        GROUP BY sha256
+    ) AS held
+    WHERE snippet_contents.sha256 = held.sha256;
@@ -5,4 +5,69 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// Highlight the lines named by a #L10-L25 style fragment. A single line is
+// also highlighted by CSS through :target, this adds ranges.
+var lineRange = /^#(.*?L)(\d+)(?:-L(\d+))?$/;
+
+function highlightLines() {
+	var highlighted = document.querySelectorAll(".line.highlighted");
+	for (var i = 0; i < highlighted.length; i++) {
+		highlighted[i].classList.remove("highlighted");
+	}
+
+	var match = lineRange.exec(window.location.hash);
+	if (!match) {
+		return;
+	}
+
+	var start = parseInt(match[2], 10);
+	var end = match[3] ? parseInt(match[3], 10) : start;
+	if (end < start) {
+		var swap = start;
+		start = end;
+		end = swap;
+	}
+
+	var first = null;
+	for (var n = start; n <= end; n++) {
+		var line = document.getElementById(match[1] + n);
+		if (!line) {
+			break;
+		}
+		line.classList.add("highlighted");
+		first = first || line;
+	}
+	if (first) {
+		first.scrollIntoView({block: "center"});
+
+		// Fill in the lines of the review comment form of the file.
+		var file = first.closest(".file");
+		var lines = file && file.querySelector(".comment-form input[name=lines]");
+		if (lines) {
+			lines.value = start == end ? start : start + "-" + end;
+		}
+	}
+}
+
+// Shift-clicking a line number extends the selection from the last line
+// that was picked to a range.
+var lineNumbers = document.querySelectorAll("pre.numbered .number");
+for (var i = 0; i < lineNumbers.length; i++) {
+	lineNumbers[i].addEventListener("click", function(event) {
+		var match = lineRange.exec(window.location.hash);
+		var target = this.getAttribute("href");
+		if (!event.shiftKey || !match || target.indexOf("#" + match[1]) != 0) {
+			return;
+		}
+		event.preventDefault();
+
+		var start = parseInt(match[2], 10);
+		var end = parseInt(target.slice(match[1].length + 1), 10);
+		window.location.hash = match[1] + Math.min(start, end) + "-L" + Math.max(start, end);
+	});
+}
+
+window.addEventListener("hashchange", highlightLines);
+highlightLines();
\ No newline at end of file